@@ -0,0 +1,142 @@
+package ghaprofiler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// WorkflowRunWithJobs is a workflow run with its jobs, which is the unit of collected data
+type WorkflowRunWithJobs struct {
+	Repository       string                `json:"repository"`
+	WorkflowFileName string                `json:"workflow_file"`
+	Run              *github.WorkflowRun   `json:"run"`
+	Jobs             []*github.WorkflowJob `json:"jobs"`
+	// Revision is the blob SHA of the workflow file at the head commit of the run, which is empty if not resolved
+	Revision string `json:"revision,omitempty"`
+	WorkflowRunAttempt
+}
+
+const archiveVersion = 1
+
+// ArchiveManifest describes the dataset stored in an archive
+type ArchiveManifest struct {
+	Version   int                `json:"version"`
+	FetchedAt time.Time          `json:"fetched_at"`
+	Workflows []*ArchiveWorkflow `json:"workflows"`
+}
+
+type ArchiveWorkflow struct {
+	Owner            string `json:"owner"`
+	Repository       string `json:"repository"`
+	WorkflowFileName string `json:"workflow_file"`
+	NumberOfRuns     int    `json:"number_of_runs"`
+}
+
+// archiveLine is a line of an archive. The first line has Manifest and the others have WorkflowRun.
+type archiveLine struct {
+	Manifest    *ArchiveManifest     `json:"manifest,omitempty"`
+	WorkflowRun *WorkflowRunWithJobs `json:"workflow_run,omitempty"`
+}
+
+// NewArchiveManifest summarizes runs into a manifest
+func NewArchiveManifest(runs []*WorkflowRunWithJobs, fetchedAt time.Time) *ArchiveManifest {
+	manifest := &ArchiveManifest{
+		Version:   archiveVersion,
+		FetchedAt: fetchedAt,
+	}
+	workflowByKey := make(map[string]*ArchiveWorkflow)
+	for _, run := range runs {
+		key := run.Repository + "\x00" + run.WorkflowFileName
+		workflow, ok := workflowByKey[key]
+		if !ok {
+			workflow = &ArchiveWorkflow{
+				WorkflowFileName: run.WorkflowFileName,
+			}
+			// repository is unknown for some input files
+			if repository, err := ParseRepositoryName(run.Repository); err == nil {
+				workflow.Owner = repository.Owner
+				workflow.Repository = repository.Name
+			}
+			workflowByKey[key] = workflow
+			manifest.Workflows = append(manifest.Workflows, workflow)
+		}
+		workflow.NumberOfRuns++
+	}
+	return manifest
+}
+
+// WriteArchive writes a manifest and runs as gzipped NDJSON
+func WriteArchive(w io.Writer, manifest *ArchiveManifest, runs []*WorkflowRunWithJobs) error {
+	gzipWriter := gzip.NewWriter(w)
+	encoder := json.NewEncoder(gzipWriter)
+	if err := encoder.Encode(&archiveLine{Manifest: manifest}); err != nil {
+		return err
+	}
+	for _, run := range runs {
+		if err := encoder.Encode(&archiveLine{WorkflowRun: run}); err != nil {
+			return err
+		}
+	}
+	return gzipWriter.Close()
+}
+
+// WriteArchiveFile writes an archive to filename
+func WriteArchiveFile(filename string, manifest *ArchiveManifest, runs []*WorkflowRunWithJobs) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	bufferedWriter := bufio.NewWriter(f)
+	if err := WriteArchive(bufferedWriter, manifest, runs); err != nil {
+		f.Close()
+		return err
+	}
+	if err := bufferedWriter.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadArchive reads an archive written by WriteArchive
+func ReadArchive(r io.Reader) (*ArchiveManifest, []*WorkflowRunWithJobs, error) {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer gzipReader.Close()
+
+	var manifest *ArchiveManifest
+	var runs []*WorkflowRunWithJobs
+	decoder := json.NewDecoder(gzipReader)
+	for {
+		var line archiveLine
+		err := decoder.Decode(&line)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case line.Manifest != nil:
+			manifest = line.Manifest
+		case line.WorkflowRun != nil:
+			runs = append(runs, line.WorkflowRun)
+		}
+	}
+	if manifest == nil {
+		return nil, nil, fmt.Errorf("Archive has no manifest")
+	}
+	if manifest.Version != archiveVersion {
+		return nil, nil, fmt.Errorf("Unsupported archive version: %d", manifest.Version)
+	}
+	return manifest, runs, nil
+}
@@ -0,0 +1,65 @@
+package ghaprofiler
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+func Test_ArchiveRoundTrip(t *testing.T) {
+	fetchedAt := time.Date(2020, 12, 15, 12, 0, 0, 0, time.UTC)
+	runs := []*WorkflowRunWithJobs{
+		{
+			Repository:       "utgwkk/Twitter-Text",
+			WorkflowFileName: "ci.yml",
+			Run:              &github.WorkflowRun{ID: github.Int64(1)},
+			Jobs: []*github.WorkflowJob{
+				{
+					ID:    github.Int64(10),
+					Name:  github.String("test"),
+					Steps: []*github.TaskStep{newTestTaskStep(1, "Set up job", "completed", "success", 3)},
+				},
+			},
+		},
+		{
+			Repository:       "utgwkk/Twitter-Text",
+			WorkflowFileName: "ci.yml",
+			Run:              &github.WorkflowRun{ID: github.Int64(2)},
+		},
+		{
+			Repository:       "utgwkk/github-actions-profiler",
+			WorkflowFileName: "ci.yml",
+			Run:              &github.WorkflowRun{ID: github.Int64(3)},
+		},
+	}
+
+	manifest := NewArchiveManifest(runs, fetchedAt)
+	if len(manifest.Workflows) != 2 {
+		t.Fatalf("expected 2 workflows in manifest, got %d", len(manifest.Workflows))
+	}
+	if w := manifest.Workflows[0]; w.Owner != "utgwkk" || w.Repository != "Twitter-Text" || w.WorkflowFileName != "ci.yml" || w.NumberOfRuns != 2 {
+		t.Fatalf("unexpected workflow in manifest: %#v", w)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteArchive(&buf, manifest, runs); err != nil {
+		t.Fatal(err)
+	}
+
+	readManifest, readRuns, err := ReadArchive(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !readManifest.FetchedAt.Equal(fetchedAt) {
+		t.Fatalf("unexpected fetched_at: %v", readManifest.FetchedAt)
+	}
+	if len(readRuns) != len(runs) {
+		t.Fatalf("expected %d runs, got %d", len(runs), len(readRuns))
+	}
+	step := readRuns[0].Jobs[0].Steps[0]
+	if step.GetName() != "Set up job" || step.CompletedAt.Sub(step.StartedAt.Time) != 3*time.Second {
+		t.Fatalf("unexpected step: %#v", step)
+	}
+}
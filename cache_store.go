@@ -0,0 +1,349 @@
+package ghaprofiler
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gregjones/httpcache/diskcache"
+)
+
+// CacheEntry is a file in the cache directory.
+// The modification time of an entry is updated whenever it is used, so it tells when the entry is used last.
+type CacheEntry struct {
+	Path string
+	// Host is the API host, or empty for entries stored before cache data were namespaced by host
+	Host string
+	// Repository is "owner/repo" for entries of a repository, or empty for entries of the HTTP cache of other URLs
+	Repository string
+	Size       int64
+	ModTime    time.Time
+}
+
+// diskCacheFilenamePattern matches the file names which diskcache uses for keys
+var diskCacheFilenamePattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// diskCacheFilename returns the file name of key in the same way as diskcache
+func diskCacheFilename(key string) string {
+	sum := md5.Sum([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ListCacheEntries returns every entry under the cache directory.
+// Files which are not written by the profiler are never returned, so that they are never removed.
+func ListCacheEntries(cacheDirectory string) ([]*CacheEntry, error) {
+	infos, err := ioutil.ReadDir(cacheDirectory)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var entries []*CacheEntry
+	for _, info := range infos {
+		path := filepath.Join(cacheDirectory, info.Name())
+		if !info.IsDir() {
+			if diskCacheFilenamePattern.MatchString(info.Name()) {
+				entries = append(entries, newCacheEntry(path, "", "", info))
+			}
+			continue
+		}
+		hostEntries, err := listHostCacheEntries(path, info.Name())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, hostEntries...)
+	}
+	return entries, nil
+}
+
+func listHostCacheEntries(hostDirectory, host string) ([]*CacheEntry, error) {
+	infos, err := ioutil.ReadDir(hostDirectory)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*CacheEntry
+	for _, info := range infos {
+		if !info.IsDir() && diskCacheFilenamePattern.MatchString(info.Name()) {
+			entries = append(entries, newCacheEntry(filepath.Join(hostDirectory, info.Name()), host, "", info))
+		}
+	}
+
+	repositoriesDirectory := filepath.Join(hostDirectory, httpCacheRepositoriesDirectoryName)
+	err = filepath.Walk(repositoriesDirectory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || !diskCacheFilenamePattern.MatchString(info.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(repositoriesDirectory, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		if segments := strings.Split(filepath.ToSlash(rel), "/"); len(segments) == 2 {
+			entries = append(entries, newCacheEntry(path, host, segments[0]+"/"+segments[1], info))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	immutableDirectory := filepath.Join(hostDirectory, immutableCacheDirectoryName)
+	err = filepath.Walk(immutableDirectory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".json" || strings.HasPrefix(info.Name(), ".tmp-") {
+			return nil
+		}
+		rel, err := filepath.Rel(immutableDirectory, path)
+		if err != nil {
+			return err
+		}
+		var repository string
+		if segments := strings.Split(filepath.ToSlash(rel), "/"); len(segments) > 2 {
+			repository = segments[0] + "/" + segments[1]
+		}
+		entries = append(entries, newCacheEntry(path, host, repository, info))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func newCacheEntry(path, host, repository string, info os.FileInfo) *CacheEntry {
+	return &CacheEntry{
+		Path:       path,
+		Host:       host,
+		Repository: repository,
+		Size:       info.Size(),
+		ModTime:    info.ModTime(),
+	}
+}
+
+// CacheStats summarizes cache entries of a repository, or of the HTTP cache of other URLs of a host
+type CacheStats struct {
+	Host       string
+	Repository string
+	Entries    int
+	Size       int64
+	Oldest     time.Time
+	Newest     time.Time
+}
+
+func (s *CacheStats) add(entry *CacheEntry) {
+	s.Entries++
+	s.Size += entry.Size
+	if s.Oldest.IsZero() || entry.ModTime.Before(s.Oldest) {
+		s.Oldest = entry.ModTime
+	}
+	if s.Newest.IsZero() || entry.ModTime.After(s.Newest) {
+		s.Newest = entry.ModTime
+	}
+}
+
+// SummarizeCacheEntries returns stats of each host and repository sorted by them, and the total
+func SummarizeCacheEntries(entries []*CacheEntry) ([]*CacheStats, *CacheStats) {
+	total := &CacheStats{}
+	statsByKey := make(map[string]*CacheStats)
+	for _, entry := range entries {
+		key := entry.Host + "\x00" + entry.Repository
+		stats, ok := statsByKey[key]
+		if !ok {
+			stats = &CacheStats{Host: entry.Host, Repository: entry.Repository}
+			statsByKey[key] = stats
+		}
+		stats.add(entry)
+		total.add(entry)
+	}
+	result := make([]*CacheStats, 0, len(statsByKey))
+	for _, stats := range statsByKey {
+		result = append(result, stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Host != result[j].Host {
+			return result[i].Host < result[j].Host
+		}
+		return result[i].Repository < result[j].Repository
+	})
+	return result, total
+}
+
+// PruneCache removes entries which are not used since olderThan, and returns the removed entries
+func PruneCache(cacheDirectory string, olderThan time.Time) ([]*CacheEntry, error) {
+	entries, err := ListCacheEntries(cacheDirectory)
+	if err != nil {
+		return nil, err
+	}
+	var removed []*CacheEntry
+	for _, entry := range entries {
+		if !entry.ModTime.Before(olderThan) {
+			continue
+		}
+		if err := removeCacheEntry(entry); err != nil {
+			return removed, err
+		}
+		removed = append(removed, entry)
+	}
+	return removed, nil
+}
+
+// EvictCache removes least recently used entries until the total size is at most maxSize,
+// and returns the removed entries
+func EvictCache(cacheDirectory string, maxSize int64) ([]*CacheEntry, error) {
+	entries, err := ListCacheEntries(cacheDirectory)
+	if err != nil {
+		return nil, err
+	}
+	var size int64
+	for _, entry := range entries {
+		size += entry.Size
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].ModTime.Before(entries[j].ModTime)
+	})
+	var removed []*CacheEntry
+	for _, entry := range entries {
+		if size <= maxSize {
+			break
+		}
+		if err := removeCacheEntry(entry); err != nil {
+			return removed, err
+		}
+		size -= entry.Size
+		removed = append(removed, entry)
+	}
+	return removed, nil
+}
+
+// ClearCache removes every entry, and returns the removed entries
+func ClearCache(cacheDirectory string) ([]*CacheEntry, error) {
+	return PruneCache(cacheDirectory, time.Now().Add(time.Hour))
+}
+
+func removeCacheEntry(entry *CacheEntry) error {
+	if err := os.Remove(entry.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// touchCacheEntry marks an entry as used now
+func touchCacheEntry(path string) {
+	now := time.Now()
+	// failing to touch only makes the entry evicted earlier
+	os.Chtimes(path, now, now)
+}
+
+// httpCacheRepositoriesDirectoryName is the directory under the cache directory of a host
+// for the HTTP cache of URLs of each repository
+const httpCacheRepositoriesDirectoryName = "repos"
+
+// lruDiskCache is diskcache.Cache which marks an entry as used on every hit
+// so that EvictCache removes least recently used entries.
+// Entries of URLs of a repository are stored under the directory of the repository.
+type lruDiskCache struct {
+	directory string
+	mu        sync.Mutex
+	caches    map[string]*diskcache.Cache
+}
+
+func newLRUDiskCache(directory string) *lruDiskCache {
+	return &lruDiskCache{
+		directory: directory,
+		caches:    make(map[string]*diskcache.Cache),
+	}
+}
+
+// cacheDirectory returns the directory of the entry of key, which is the URL of a request
+func (c *lruDiskCache) cacheDirectory(key string) string {
+	if repository := repositoryFromURL(key); repository != "" {
+		return filepath.Join(c.directory, httpCacheRepositoriesDirectoryName, filepath.FromSlash(repository))
+	}
+	return c.directory
+}
+
+func (c *lruDiskCache) cache(directory string) *diskcache.Cache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cache, ok := c.caches[directory]
+	if !ok {
+		cache = diskcache.New(directory)
+		c.caches[directory] = cache
+	}
+	return cache
+}
+
+func (c *lruDiskCache) Get(key string) ([]byte, bool) {
+	directory := c.cacheDirectory(key)
+	resp, ok := c.cache(directory).Get(key)
+	if ok {
+		touchCacheEntry(filepath.Join(directory, diskCacheFilename(key)))
+	}
+	return resp, ok
+}
+
+func (c *lruDiskCache) Set(key string, resp []byte) {
+	c.cache(c.cacheDirectory(key)).Set(key, resp)
+}
+
+func (c *lruDiskCache) Delete(key string) {
+	c.cache(c.cacheDirectory(key)).Delete(key)
+}
+
+var byteSizePattern = regexp.MustCompile(`^(\d+)\s*([KMGT]?)(IB|B)?$`)
+
+var byteSizeUnits = map[string]int64{
+	"":  1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+// ParseByteSize parses a size such as "500MB" or "1GiB". Units are powers of 1024.
+func ParseByteSize(s string) (int64, error) {
+	m := byteSizePattern.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(s)))
+	if m == nil || (m[2] == "" && m[3] == "IB") {
+		return 0, fmt.Errorf("Invalid size: %s", s)
+	}
+	n, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid size: %s", s)
+	}
+	return n * byteSizeUnits[m[2]], nil
+}
+
+// FormatByteSize formats a size in the largest unit which keeps it at least 1
+func FormatByteSize(size int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
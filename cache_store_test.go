@@ -0,0 +1,202 @@
+package ghaprofiler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestCacheDirectory creates entries of the HTTP cache and ImmutableCache used at the given times,
+// and a file which is not a cache entry
+func newTestCacheDirectory(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []struct {
+		path    string
+		size    int
+		modTime time.Time
+	}{
+		{filepath.Join("api.github.com", diskCacheFilename("list")), 100, testBaseTime},
+		{filepath.Join("api.github.com", immutableCacheDirectoryName, "owner", "repo", "runs", "1", "jobs-latest-0.json"), 200, testBaseTime.Add(time.Hour)},
+		{filepath.Join("api.github.com", immutableCacheDirectoryName, "owner", "repo", "runs", "2", "jobs-latest-0.json"), 300, testBaseTime.Add(2 * time.Hour)},
+		{filepath.Join("github.example.com", immutableCacheDirectoryName, "owner", "other", "runs", "3", "jobs-latest-0.json"), 400, testBaseTime.Add(3 * time.Hour)},
+		{filepath.Join("api.github.com", httpCacheRepositoriesDirectoryName, "owner", "repo", diskCacheFilename("runs")), 50, testBaseTime.Add(4 * time.Hour)},
+		{"README.txt", 500, testBaseTime},
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, f.path)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, make([]byte, f.size), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, f.modTime, f.modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func Test_SummarizeCacheEntries(t *testing.T) {
+	dir, teardown := newTestCacheDirectory(t)
+	defer teardown()
+
+	entries, err := ListCacheEntries(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, total := SummarizeCacheEntries(entries)
+	if total.Entries != 5 || total.Size != 1050 {
+		t.Fatalf("expected 5 entries of 1050 bytes, got %d entries of %d bytes", total.Entries, total.Size)
+	}
+	if !total.Oldest.Equal(testBaseTime) || !total.Newest.Equal(testBaseTime.Add(4*time.Hour)) {
+		t.Fatalf("unexpected oldest %v and newest %v", total.Oldest, total.Newest)
+	}
+	expected := []CacheStats{
+		{Host: "api.github.com", Repository: "", Entries: 1, Size: 100},
+		{Host: "api.github.com", Repository: "owner/repo", Entries: 3, Size: 550},
+		{Host: "github.example.com", Repository: "owner/other", Entries: 1, Size: 400},
+	}
+	if len(stats) != len(expected) {
+		t.Fatalf("expected %d stats, got %d", len(expected), len(stats))
+	}
+	for i, e := range expected {
+		s := stats[i]
+		if s.Host != e.Host || s.Repository != e.Repository || s.Entries != e.Entries || s.Size != e.Size {
+			t.Errorf("stats[%d]: expected %+v, got %+v", i, e, *s)
+		}
+	}
+}
+
+func Test_PruneCache(t *testing.T) {
+	dir, teardown := newTestCacheDirectory(t)
+	defer teardown()
+
+	removed, err := PruneCache(dir, testBaseTime.Add(90*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 {
+		t.Fatalf("expected 2 entries removed, got %d", len(removed))
+	}
+	entries, err := ListCacheEntries(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries left, got %d", len(entries))
+	}
+}
+
+func Test_EvictCache(t *testing.T) {
+	dir, teardown := newTestCacheDirectory(t)
+	defer teardown()
+
+	removed, err := EvictCache(dir, 750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the least recently used entries of 100 and 200 bytes are removed
+	if len(removed) != 2 || removed[0].Size != 100 || removed[1].Size != 200 {
+		t.Fatalf("unexpected removed entries: %+v", removed)
+	}
+}
+
+func Test_LRUDiskCacheStoresEntriesOfRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache := newLRUDiskCache(filepath.Join(dir, "api.github.com"))
+	cache.Set("https://api.github.com/repos/owner/repo/actions/runs", []byte("runs"))
+	cache.Set("https://api.github.com/user", []byte("user"))
+	if resp, ok := cache.Get("https://api.github.com/repos/owner/repo/actions/runs"); !ok || string(resp) != "runs" {
+		t.Fatalf("unexpected cached response: %q", resp)
+	}
+
+	entries, err := ListCacheEntries(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, _ := SummarizeCacheEntries(entries)
+	if len(stats) != 2 || stats[0].Repository != "" || stats[1].Repository != "owner/repo" {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	cache.Delete("https://api.github.com/repos/owner/repo/actions/runs")
+	if _, ok := cache.Get("https://api.github.com/repos/owner/repo/actions/runs"); ok {
+		t.Fatal("expected the entry to be deleted")
+	}
+}
+
+func Test_ClearCache(t *testing.T) {
+	dir, teardown := newTestCacheDirectory(t)
+	defer teardown()
+
+	if _, err := ClearCache(dir); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ListCacheEntries(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected no entries left, got %d", len(entries))
+	}
+	// files which are not written by the profiler must be kept
+	if _, err := os.Stat(filepath.Join(dir, "README.txt")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_ParseByteSize(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected int64
+	}{
+		{"1024", 1024},
+		{"10B", 10},
+		{"1K", 1 << 10},
+		{"500MB", 500 << 20},
+		{"2GiB", 2 << 30},
+		{"1 gb", 1 << 30},
+	}
+	for _, tc := range testCases {
+		got, err := ParseByteSize(tc.input)
+		if err != nil {
+			t.Errorf("%s: %v", tc.input, err)
+			continue
+		}
+		if got != tc.expected {
+			t.Errorf("%s: expected %d, got %d", tc.input, tc.expected, got)
+		}
+	}
+	for _, input := range []string{"", "MB", "1.5GB", "10iB", "-1"} {
+		if _, err := ParseByteSize(input); err == nil {
+			t.Errorf("%s: expected an error", input)
+		}
+	}
+}
+
+func Test_FormatByteSize(t *testing.T) {
+	testCases := []struct {
+		input    int64
+		expected string
+	}{
+		{512, "512 B"},
+		{1536, "1.5 KiB"},
+		{500 << 20, "500.0 MiB"},
+	}
+	for _, tc := range testCases {
+		if got := FormatByteSize(tc.input); got != tc.expected {
+			t.Errorf("%d: expected %s, got %s", tc.input, tc.expected, got)
+		}
+	}
+}
@@ -2,16 +2,30 @@ package ghaprofiler
 
 import (
 	"context"
+	"io/ioutil"
 	"log"
 	"os"
-	"regexp"
-	"sort"
-	"strings"
+	"time"
 
-	"github.com/go-git/go-git/v5"
-	"github.com/google/go-github/v32/github"
 	"github.com/jessevdk/go-flags"
-	"golang.org/x/sync/errgroup"
+)
+
+// Exit codes returned by CLI.Start
+const (
+	ExitCodeOK = 0
+	// ExitCodeError is returned when profiling fails
+	ExitCodeError = 1
+	// ExitCodeUsage is returned for invalid arguments
+	ExitCodeUsage = 2
+	// ExitCodePartial is returned when fetching is interrupted and a partial profile is written
+	ExitCodePartial = 3
+)
+
+const (
+	// commandSync stores workflow runs to the database
+	commandSync = "sync"
+	// commandProfile profiles workflow runs in the database
+	commandProfile = "profile"
 )
 
 type CLI struct {
@@ -47,50 +61,52 @@ func (cli *CLI) logfVerbose(format string, args ...interface{}) {
 	log.Printf(format, args...)
 }
 
-func (cli *CLI) overrideRepositoryFromCWD(config *ProfileConfig) {
+func (cli *CLI) overrideRepositoryFromCWD(config *ProfileConfig) error {
 	if config.Owner != "" && config.Repository != "" {
-		return
-	}
-	cwd, err := os.Getwd()
-	if err != nil {
-		return
+		return nil
 	}
-	repo, err := git.PlainOpen(cwd)
+	_, remoteURL, err := openLocalRepository(config.Remote)
 	if err != nil {
 		cli.loglnVerbose(err)
-		return
+		return nil
 	}
-	remote, err := repo.Remote("origin")
-	if err != nil {
-		cli.loglnVerbose(err)
-		return
-	}
-	urls := remote.Config().URLs
-	if len(urls) == 0 {
-		return
-	}
-	url := urls[0]
-	splitted := strings.Split(url, "/")
-	if len(splitted) <= 1 {
-		return
-	}
-	owner, repoName := splitted[len(splitted)-2], splitted[len(splitted)-1]
-	repoName = strings.Replace(repoName, ".git", "", 1)
-	if lastColonPos := strings.LastIndex(owner, ":"); lastColonPos != -1 {
-		// git@github.com:owner/repo.git
-		owner = owner[lastColonPos:]
+
+	if config.BaseURL == "" {
+		baseURL, uploadURL, err := remoteURL.APIURLs(config.EnterpriseHosts)
+		if err != nil {
+			return err
+		}
+		if baseURL != "" {
+			config.BaseURL = baseURL
+			config.UploadURL = uploadURL
+			cli.logfVerbose("GitHub Enterprise Server detected: %s", remoteURL.Host)
+		}
 	}
-	config.Owner = owner
-	config.Repository = repoName
+
+	config.Owner = remoteURL.Repository.Owner
+	config.Repository = remoteURL.Repository.Name
+	cli.logfVerbose("Repository %s detected from remote %s", remoteURL.Repository, config.Remote)
+	return nil
 }
 
-func (cli *CLI) Start(ctx context.Context, args []string) {
+// Start runs the command with args and returns an exit code
+func (cli *CLI) Start(ctx context.Context, args []string) int {
+	var command string
+	if len(args) > 0 {
+		switch args[0] {
+		case "cache":
+			return cli.startCacheCommand(args[1:])
+		case commandSync, commandProfile:
+			command, args = args[0], args[1:]
+		}
+	}
+
 	var config *ProfileConfig = DefaultProfileConfig()
 	var configFromArgs ProfileConfigCLIArgs
 	args, err := flags.ParseArgs(&configFromArgs, args)
 	if err != nil {
 		// flags.ParseArgs() outputs error message, so discarding it here...
-		return
+		return exitCodeOfFlagsError(err)
 	}
 
 	var configTomlPath string
@@ -98,131 +114,105 @@ func (cli *CLI) Start(ctx context.Context, args []string) {
 		configTomlPath = *configFromArgs.ConfigPath
 		configFromTOML, err := LoadConfigFromTOML(configTomlPath)
 		if err != nil {
-			log.Fatalf("Failed to load %s: %v", configTomlPath, err)
+			log.Printf("Failed to load %s: %v", configTomlPath, err)
+			return ExitCodeError
 		}
 		config = OverrideCLIArgs(configFromTOML, &configFromArgs)
 	} else {
 		config = OverrideCLIArgs(DefaultProfileConfig(), &configFromArgs)
 	}
-	cli.overrideRepositoryFromCWD(config)
 	cli.SetVerbosity(config.Verbose)
+	if !config.IsMultiRepository() {
+		if err := cli.overrideRepositoryFromCWD(config); err != nil {
+			log.Println(err)
+			return ExitCodeUsage
+		}
+	}
 
 	cli.logfVerbose("config=%v", configTomlPath)
 	cli.logVerbose(config.Dump())
 
-	if err := config.Validate(); err != nil {
-		log.Fatal(err)
+	// profile command loads workflow runs from the database instead of fetching them
+	if err := config.validate(config.IsOffline() || command == commandProfile); err != nil {
+		log.Println(err)
+		return ExitCodeUsage
 	}
 
-	jobNameRegex, err := regexp.Compile(config.JobNameRegexp)
-	if err != nil {
-		log.Fatal(err)
+	if config.Timeout != "" {
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			log.Println(err)
+			return ExitCodeUsage
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
-	client := NewClientWithConfig(ctx, &ClientConfig{
-		AccessToken:    config.AccessToken,
-		Cache:          config.Cache,
-		CacheDirectory: config.CacheDirectory,
-	})
-
-	listWorkflowRunsOpts := &github.ListWorkflowRunsOptions{
-		ListOptions: github.ListOptions{
-			PerPage: config.NumberOfJob,
-		},
+	opts := []ProfilerOption{WithConfig(config)}
+	if command != "" {
+		db, err := OpenDatabase(config.Database)
+		if err != nil {
+			log.Printf("Failed to open %s: %v", config.Database, err)
+			return ExitCodeError
+		}
+		defer db.Close()
+		opts = append(opts, WithDatabase(db))
 	}
-
-	cli.loglnVerbose("ListWorkflowRunsByFileName start")
-	workflowRuns, _, err := client.ListWorkflowRunsByFileName(ctx, config.Owner, config.Repository, config.WorkflowFileName, listWorkflowRunsOpts)
-	if err != nil {
-		log.Fatal(err)
-	}
-	cli.loglnVerbose("ListWorkflowRunsByFileName finish")
-
-	jobsByJobName := NewJobsByJobNameMap()
-	eg := new(errgroup.Group)
-	sem := make(chan struct{}, config.Concurrency)
-
-	for _, run := range workflowRuns.WorkflowRuns {
-		sem <- struct{}{}
-		eg.Go(func() error {
-			defer func() {
-				<-sem
-			}()
-			cli.logfVerbose("ListWorkflowJobs start: run_id=%d", *run.ID)
-			jobs, _, err := client.ListWorkflowJobs(ctx, config.Owner, config.Repository, *run.ID, nil)
-			if err != nil {
-				return err
-			}
-			cli.logfVerbose("ListWorkflowJobs finish: run_id=%d", *run.ID)
-
-			for _, job := range jobs.Jobs {
-				jobName := *job.Name
-				if !jobNameRegex.MatchString(jobName) {
-					continue
-				}
-				cli.logfVerbose("Job name (before replacement): %#v", jobName)
-				for _, rule := range config.Replace {
-					jobName = rule.Apply(jobName)
-				}
-				cli.logfVerbose("Job name (after replacement): %#v", jobName)
-				jobsByJobName.Append(jobName, job)
-			}
-			return nil
-		})
+	if config.Quiet {
+		opts = append(opts, WithLogger(log.New(ioutil.Discard, "", 0)))
+	} else {
+		progress := NewProgress(os.Stderr)
+		defer log.SetOutput(log.Writer())
+		log.SetOutput(progress.Writer())
+		opts = append(opts, WithProgress(progress))
 	}
-
-	if err = eg.Wait(); err != nil {
-		log.Fatal(err)
+	profiler, err := NewProfiler(opts...)
+	if err != nil {
+		log.Println(err)
+		return ExitCodeError
 	}
 
-	profileResult := make(map[string][]*TaskStepProfile)
-
-	for jobName, jobs := range jobsByJobName.Iterate() {
-		if len(jobs) == 0 {
-			continue
+	if command == commandSync {
+		if err := profiler.Sync(ctx); err != nil {
+			if ctx.Err() != nil {
+				log.Printf("%s; workflow runs fetched so far are stored", interruptionReason(ctx))
+			} else {
+				log.Println(err)
+			}
+			return ExitCodeError
 		}
+		return ExitCodeOK
+	}
 
-		var steps []*github.TaskStep
-		for _, job := range jobs {
-			steps = append(steps, job.Steps...)
-		}
+	result, err := profiler.Run(ctx)
+	if err != nil {
+		log.Println(err)
+		return ExitCodeError
+	}
 
-		stepProfile, err := ProfileTaskStep(steps)
-		if err != nil {
-			log.Fatal(err)
+	if config.Record != "" {
+		manifest := NewArchiveManifest(result.WorkflowRuns, result.FetchedAt)
+		if err := WriteArchiveFile(config.Record, manifest, result.WorkflowRuns); err != nil {
+			log.Printf("Failed to record to %s: %v", config.Record, err)
+			return ExitCodeError
 		}
-		err = SortProfileBy(stepProfile, config.SortBy)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		// reverse slice
-		if config.Reverse {
-			reversedStepProfile := make(TaskStepProfileResult, len(stepProfile))
-			for i := 0; i < len(stepProfile); i++ {
-				j := len(stepProfile) - i - 1
-				reversedStepProfile[i] = stepProfile[j]
-			}
-			profileResult[jobName] = reversedStepProfile
-		} else {
-			profileResult[jobName] = stepProfile
+		if !config.Quiet {
+			log.Printf("Recorded %d workflow runs to %s", len(result.WorkflowRuns), config.Record)
 		}
 	}
 
-	var formatterInputJobNames []string
-	for k := range profileResult {
-		formatterInputJobNames = append(formatterInputJobNames, k)
+	WriteWithFormat(os.Stdout, result.Workflows, config.Format)
+	if result.Partial {
+		return ExitCodePartial
 	}
-	sort.Strings(formatterInputJobNames)
+	return ExitCodeOK
+}
 
-	var profileFormatterInput ProfileInput
-	for _, jobName := range formatterInputJobNames {
-		result := profileResult[jobName]
-		profileFormatterInput = append(profileFormatterInput, &ProfileForFormatter{
-			Name:    jobName,
-			Profile: result,
-		})
+// exitCodeOfFlagsError returns an exit code for an error of parsing arguments
+func exitCodeOfFlagsError(err error) int {
+	if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+		return ExitCodeOK
 	}
-
-	WriteWithFormat(os.Stdout, profileFormatterInput, config.Format)
+	return ExitCodeUsage
 }
@@ -3,20 +3,52 @@ package ghaprofiler
 // ProfileConfigCLIArgs is a set of option from command-line arguments
 // see DefaultProfileConfig() in config.go for more details
 type ProfileConfigCLIArgs struct {
-	AccessToken      *string `long:"access-token" description:"Access token for GitHub" env:"GITHUB_ACTIONS_PROFILER_TOKEN"`
-	Cache            *bool   `long:"cache" description:"Enable disk cache" default-mask:"true"`
-	CacheDirectory   *string `long:"cache-dir" description:"Where to store cache data"`
-	Concurrency      *int    `long:"concurrency" short:"j" description:"Concurrency of GitHub API client" default-mask:"2"`
-	ConfigPath       *string `long:"config" description:"Path to configuration TOML file"`
-	NumberOfJob      *int    `long:"number-of-job" short:"n" description:"The number of job to analyze" default-mask:"20"`
-	Format           *string `long:"format" short:"f" description:"Output format" default-mask:"table" choice:"table" choice:"json" choice:"tsv" choice:"markdown"`
-	JobNameRegexp    *string `long:"job-name-regexp" description:"Filter regular expression for a job name"`
-	Owner            *string `long:"owner" description:"Repository owner name"`
-	Repository       *string `long:"repository" description:"Repository name"`
-	Reverse          *bool   `long:"reverse" short:"r" description:"Reverse the result of sort" default-mask:"false"`
-	SortBy           *string `long:"sort" short:"s" description:"A field name to sort by" default-mask:"number"`
-	Verbose          *bool   `long:"verbose" description:"Verbose mode"`
-	WorkflowFileName *string `long:"workflow-file" description:"Workflow file name"`
+	AccessToken         *string  `long:"access-token" description:"Access token for GitHub" env:"GITHUB_ACTIONS_PROFILER_TOKEN"`
+	Actor               *string  `long:"actor" description:"Filter workflow runs by the user who triggered them"`
+	AdaptiveConcurrency *bool    `long:"adaptive-concurrency" description:"Change concurrency by observing latency and rate limits" default-mask:"false"`
+	AllAttempts         *bool    `long:"all-attempts" description:"Include jobs of every attempt of a workflow run" default-mask:"false"`
+	AllWorkflows        *bool    `long:"all-workflows" description:"Profile all workflows of the repository" default-mask:"false"`
+	AppID               *int64   `long:"app-id" description:"Authenticate as a GitHub App with the app ID" env:"GITHUB_ACTIONS_PROFILER_APP_ID"`
+	AppInstallationID   *int64   `long:"app-installation-id" description:"Installation ID of the GitHub App" env:"GITHUB_ACTIONS_PROFILER_APP_INSTALLATION_ID"`
+	AppPrivateKeyPath   *string  `long:"app-private-key" description:"Path to the private key PEM file of the GitHub App" env:"GITHUB_ACTIONS_PROFILER_APP_PRIVATE_KEY"`
+	BaseURL             *string  `long:"base-url" description:"Base URL of GitHub Enterprise Server API (e.g. https://github.example.com/api/v3/)"`
+	Branch              *string  `long:"branch" description:"Filter workflow runs by branch"`
+	Cache               *bool    `long:"cache" description:"Enable disk cache" default-mask:"true"`
+	CacheDirectory      *string  `long:"cache-dir" description:"Where to store cache data"`
+	CacheMaxSize        *string  `long:"cache-max-size" description:"Remove least recently used cache entries when the cache exceeds the size (e.g. 500MB)"`
+	Concurrency         *int     `long:"concurrency" short:"j" description:"Concurrency of GitHub API client" default-mask:"2"`
+	Conclusion          *string  `long:"conclusion" description:"Filter workflow runs by conclusion (e.g. success, failure, cancelled)"`
+	ConfigPath          *string  `long:"config" description:"Path to configuration TOML file"`
+	Database            *string  `long:"database" description:"Path to the database for sync and profile commands"`
+	DiscoverOwner       *string  `long:"discover-owner" description:"Profile every repository of the organization or the user"`
+	EnterpriseHosts     []string `long:"enterprise-hosts" description:"Hosts of GitHub Enterprise Server used when the repository is detected from a git remote on the host (may be passed multiple times)"`
+	Event               *string  `long:"event" description:"Filter workflow runs by event (e.g. push, pull_request)"`
+	NumberOfJob         *int     `long:"number-of-job" short:"n" description:"The number of job to analyze" default-mask:"20"`
+	Format              *string  `long:"format" short:"f" description:"Output format" default-mask:"table" choice:"table" choice:"json" choice:"tsv" choice:"markdown"`
+	GroupByRevision     *bool    `long:"group-by-revision" description:"Profile workflow runs of each revision of the workflow file separately" default-mask:"false"`
+	IncludeSkippedSteps *bool    `long:"include-skipped-steps" description:"Include skipped and cancelled steps in timing statistics" default-mask:"false"`
+	Inputs              []string `long:"input" description:"Analyze workflow runs in the file recorded with --record or dumped by gh, instead of fetching from GitHub (may be passed multiple times)"`
+	JobNameRegexp       *string  `long:"job-name-regexp" description:"Filter regular expression for a job name"`
+	Levels              []string `long:"level" description:"Level of profiles to output (may be passed multiple times, Default: every level)" choice:"run" choice:"job" choice:"step"`
+	MaxConcurrency      *int     `long:"max-concurrency" description:"The upper limit of concurrency in adaptive concurrency mode" default-mask:"10"`
+	MaxRetries          *int     `long:"max-retries" description:"How many times to retry a request failed by rate limits or server errors" default-mask:"5"`
+	Owner               *string  `long:"owner" description:"Repository owner name"`
+	Quiet               *bool    `long:"quiet" short:"q" description:"Show neither progress nor informational messages"`
+	Record              *string  `long:"record" description:"Record fetched workflow runs and jobs to a gzipped NDJSON archive"`
+	Remote              *string  `long:"remote" description:"Git remote to detect the repository from" default-mask:"origin"`
+	Repository          *string  `long:"repository" description:"Repository name"`
+	Repositories        []string `long:"repositories" description:"Repositories to profile in owner/repo form (may be passed multiple times)"`
+	Reverse             *bool    `long:"reverse" short:"r" description:"Reverse the result of sort" default-mask:"false"`
+	Revisions           []string `long:"revision" description:"Analyze workflow runs of the revision of the workflow file, which is a blob SHA or its prefix, or latest (may be passed multiple times)"`
+	Since               *string  `long:"since" description:"Analyze workflow runs created after the time (YYYY-MM-DD, RFC 3339 or relative such as 14d)"`
+	SortBy              *string  `long:"sort" short:"s" description:"A field name to sort by" default-mask:"number"`
+	StepKey             *string  `long:"step-key" description:"How to identify the same step among jobs" default-mask:"number" choice:"number" choice:"name" choice:"aligned"`
+	Status              *string  `long:"status" description:"Filter workflow runs by status (e.g. completed, in_progress)"`
+	Timeout             *string  `long:"timeout" description:"Stop fetching after the duration (e.g. 5m) and profile workflow runs fetched so far"`
+	Until               *string  `long:"until" description:"Analyze workflow runs created before the time (YYYY-MM-DD for the end of the day, RFC 3339 or relative such as 14d)"`
+	UploadURL           *string  `long:"upload-url" description:"Upload URL of GitHub Enterprise Server API (Default: base-url)"`
+	Verbose             *bool    `long:"verbose" description:"Verbose mode"`
+	WorkflowFiles       []string `long:"workflow-file" description:"Workflow file name or glob pattern (may be passed multiple times)"`
 }
 
 func OverrideCLIArgs(tomlConfig *ProfileConfig, cliArgs *ProfileConfigCLIArgs) (newConfig *ProfileConfig) {
@@ -26,6 +58,41 @@ func OverrideCLIArgs(tomlConfig *ProfileConfig, cliArgs *ProfileConfigCLIArgs) (
 	} else {
 		newConfig.AccessToken = tomlConfig.AccessToken
 	}
+	if cliArgs.AppID != nil {
+		newConfig.AppID = *cliArgs.AppID
+	} else {
+		newConfig.AppID = tomlConfig.AppID
+	}
+	if cliArgs.AppInstallationID != nil {
+		newConfig.AppInstallationID = *cliArgs.AppInstallationID
+	} else {
+		newConfig.AppInstallationID = tomlConfig.AppInstallationID
+	}
+	if cliArgs.AppPrivateKeyPath != nil {
+		newConfig.AppPrivateKeyPath = *cliArgs.AppPrivateKeyPath
+	} else {
+		newConfig.AppPrivateKeyPath = tomlConfig.AppPrivateKeyPath
+	}
+	if cliArgs.AllAttempts != nil {
+		newConfig.AllAttempts = *cliArgs.AllAttempts
+	} else {
+		newConfig.AllAttempts = tomlConfig.AllAttempts
+	}
+	if cliArgs.BaseURL != nil {
+		newConfig.BaseURL = *cliArgs.BaseURL
+	} else {
+		newConfig.BaseURL = tomlConfig.BaseURL
+	}
+	if cliArgs.UploadURL != nil {
+		newConfig.UploadURL = *cliArgs.UploadURL
+	} else {
+		newConfig.UploadURL = tomlConfig.UploadURL
+	}
+	if len(cliArgs.EnterpriseHosts) > 0 {
+		newConfig.EnterpriseHosts = cliArgs.EnterpriseHosts
+	} else {
+		newConfig.EnterpriseHosts = tomlConfig.EnterpriseHosts
+	}
 	if cliArgs.Cache != nil {
 		newConfig.Cache = *cliArgs.Cache
 	} else {
@@ -36,11 +103,31 @@ func OverrideCLIArgs(tomlConfig *ProfileConfig, cliArgs *ProfileConfigCLIArgs) (
 	} else {
 		newConfig.CacheDirectory = tomlConfig.CacheDirectory
 	}
+	if cliArgs.CacheMaxSize != nil {
+		newConfig.CacheMaxSize = *cliArgs.CacheMaxSize
+	} else {
+		newConfig.CacheMaxSize = tomlConfig.CacheMaxSize
+	}
 	if cliArgs.Concurrency != nil {
 		newConfig.Concurrency = *cliArgs.Concurrency
 	} else {
 		newConfig.Concurrency = tomlConfig.Concurrency
 	}
+	if cliArgs.MaxRetries != nil {
+		newConfig.MaxRetries = *cliArgs.MaxRetries
+	} else {
+		newConfig.MaxRetries = tomlConfig.MaxRetries
+	}
+	if cliArgs.AdaptiveConcurrency != nil {
+		newConfig.AdaptiveConcurrency = *cliArgs.AdaptiveConcurrency
+	} else {
+		newConfig.AdaptiveConcurrency = tomlConfig.AdaptiveConcurrency
+	}
+	if cliArgs.MaxConcurrency != nil {
+		newConfig.MaxConcurrency = *cliArgs.MaxConcurrency
+	} else {
+		newConfig.MaxConcurrency = tomlConfig.MaxConcurrency
+	}
 	if cliArgs.NumberOfJob != nil {
 		newConfig.NumberOfJob = *cliArgs.NumberOfJob
 	} else {
@@ -51,6 +138,11 @@ func OverrideCLIArgs(tomlConfig *ProfileConfig, cliArgs *ProfileConfigCLIArgs) (
 	} else {
 		newConfig.Format = tomlConfig.Format
 	}
+	if cliArgs.IncludeSkippedSteps != nil {
+		newConfig.IncludeSkippedSteps = *cliArgs.IncludeSkippedSteps
+	} else {
+		newConfig.IncludeSkippedSteps = tomlConfig.IncludeSkippedSteps
+	}
 	if cliArgs.JobNameRegexp != nil {
 		newConfig.JobNameRegexp = *cliArgs.JobNameRegexp
 	} else {
@@ -66,7 +158,37 @@ func OverrideCLIArgs(tomlConfig *ProfileConfig, cliArgs *ProfileConfigCLIArgs) (
 	} else {
 		newConfig.Repository = tomlConfig.Repository
 	}
+	if len(cliArgs.Repositories) > 0 {
+		newConfig.Repositories = cliArgs.Repositories
+	} else {
+		newConfig.Repositories = tomlConfig.Repositories
+	}
+	if cliArgs.Remote != nil {
+		newConfig.Remote = *cliArgs.Remote
+	} else {
+		newConfig.Remote = tomlConfig.Remote
+	}
+	if cliArgs.Database != nil {
+		newConfig.Database = *cliArgs.Database
+	} else {
+		newConfig.Database = tomlConfig.Database
+	}
+	if cliArgs.DiscoverOwner != nil {
+		newConfig.DiscoverOwner = *cliArgs.DiscoverOwner
+	} else {
+		newConfig.DiscoverOwner = tomlConfig.DiscoverOwner
+	}
 	newConfig.Replace = tomlConfig.Replace
+	if cliArgs.Record != nil {
+		newConfig.Record = *cliArgs.Record
+	} else {
+		newConfig.Record = tomlConfig.Record
+	}
+	if len(cliArgs.Inputs) > 0 {
+		newConfig.Inputs = cliArgs.Inputs
+	} else {
+		newConfig.Inputs = tomlConfig.Inputs
+	}
 	if cliArgs.Reverse != nil {
 		newConfig.Reverse = *cliArgs.Reverse
 	} else {
@@ -82,10 +204,81 @@ func OverrideCLIArgs(tomlConfig *ProfileConfig, cliArgs *ProfileConfigCLIArgs) (
 	} else {
 		newConfig.Verbose = tomlConfig.Verbose
 	}
-	if cliArgs.WorkflowFileName != nil {
-		newConfig.WorkflowFileName = *cliArgs.WorkflowFileName
+	if cliArgs.StepKey != nil {
+		newConfig.StepKey = *cliArgs.StepKey
+	} else {
+		newConfig.StepKey = tomlConfig.StepKey
+	}
+	if cliArgs.GroupByRevision != nil {
+		newConfig.GroupByRevision = *cliArgs.GroupByRevision
+	} else {
+		newConfig.GroupByRevision = tomlConfig.GroupByRevision
+	}
+	if len(cliArgs.Revisions) > 0 {
+		newConfig.Revisions = cliArgs.Revisions
+	} else {
+		newConfig.Revisions = tomlConfig.Revisions
+	}
+	if len(cliArgs.Levels) > 0 {
+		newConfig.Levels = cliArgs.Levels
+	} else {
+		newConfig.Levels = tomlConfig.Levels
+	}
+	if cliArgs.Quiet != nil {
+		newConfig.Quiet = *cliArgs.Quiet
+	} else {
+		newConfig.Quiet = tomlConfig.Quiet
+	}
+	if len(cliArgs.WorkflowFiles) > 0 {
+		newConfig.WorkflowFiles = cliArgs.WorkflowFiles
 	} else {
 		newConfig.WorkflowFileName = tomlConfig.WorkflowFileName
+		newConfig.WorkflowFiles = tomlConfig.WorkflowFiles
+	}
+	if cliArgs.AllWorkflows != nil {
+		newConfig.AllWorkflows = *cliArgs.AllWorkflows
+	} else {
+		newConfig.AllWorkflows = tomlConfig.AllWorkflows
+	}
+	if cliArgs.Branch != nil {
+		newConfig.Branch = *cliArgs.Branch
+	} else {
+		newConfig.Branch = tomlConfig.Branch
+	}
+	if cliArgs.Event != nil {
+		newConfig.Event = *cliArgs.Event
+	} else {
+		newConfig.Event = tomlConfig.Event
+	}
+	if cliArgs.Status != nil {
+		newConfig.Status = *cliArgs.Status
+	} else {
+		newConfig.Status = tomlConfig.Status
+	}
+	if cliArgs.Conclusion != nil {
+		newConfig.Conclusion = *cliArgs.Conclusion
+	} else {
+		newConfig.Conclusion = tomlConfig.Conclusion
+	}
+	if cliArgs.Actor != nil {
+		newConfig.Actor = *cliArgs.Actor
+	} else {
+		newConfig.Actor = tomlConfig.Actor
+	}
+	if cliArgs.Since != nil {
+		newConfig.Since = *cliArgs.Since
+	} else {
+		newConfig.Since = tomlConfig.Since
+	}
+	if cliArgs.Timeout != nil {
+		newConfig.Timeout = *cliArgs.Timeout
+	} else {
+		newConfig.Timeout = tomlConfig.Timeout
+	}
+	if cliArgs.Until != nil {
+		newConfig.Until = *cliArgs.Until
+	} else {
+		newConfig.Until = tomlConfig.Until
 	}
 	return
 }
@@ -35,3 +35,20 @@ func Test_OverrideToFalse(t *testing.T) {
 		t.Fatal("Unexpected --reverse")
 	}
 }
+
+func Test_OverrideWorkflowFiles(t *testing.T) {
+	beforeConfig := DefaultProfileConfig()
+	beforeConfig.WorkflowFileName = "ci.yml"
+
+	config := OverrideCLIArgs(beforeConfig, &ProfileConfigCLIArgs{})
+	if len(config.WorkflowFilePatterns()) != 1 || config.WorkflowFilePatterns()[0] != "ci.yml" {
+		t.Fatalf("Unexpected workflow files: %v", config.WorkflowFilePatterns())
+	}
+
+	config = OverrideCLIArgs(beforeConfig, &ProfileConfigCLIArgs{
+		WorkflowFiles: []string{"test.yml", "lint.yml"},
+	})
+	if len(config.WorkflowFilePatterns()) != 2 {
+		t.Fatalf("Unexpected workflow files: %v", config.WorkflowFilePatterns())
+	}
+}
@@ -0,0 +1,163 @@
+package ghaprofiler
+
+import (
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/olekukonko/tablewriter"
+)
+
+// CacheCommandCLIArgs is a set of option of the cache subcommand
+type CacheCommandCLIArgs struct {
+	CacheDirectory *string `long:"cache-dir" description:"Where to store cache data"`
+	ConfigPath     *string `long:"config" description:"Path to configuration TOML file"`
+	MaxSize        *string `long:"max-size" description:"Remove least recently used entries until the cache fits in the size (e.g. 500MB) with prune"`
+	OlderThan      *string `long:"older-than" description:"Remove entries not used since the time (YYYY-MM-DD, RFC 3339 or relative such as 30d) with prune"`
+	Verbose        *bool   `long:"verbose" description:"Verbose mode"`
+}
+
+const cacheCommandUsage = "[OPTIONS] stats|prune|clear"
+
+// startCacheCommand inspects or cleans the cache directory
+func (cli *CLI) startCacheCommand(args []string) int {
+	var cacheArgs CacheCommandCLIArgs
+	parser := flags.NewParser(&cacheArgs, flags.Default)
+	parser.Name += " cache"
+	parser.Usage = cacheCommandUsage
+	args, err := parser.ParseArgs(args)
+	if err != nil {
+		// flags outputs error message, so discarding it here...
+		return exitCodeOfFlagsError(err)
+	}
+	if len(args) != 1 {
+		log.Printf("Usage: %s %s", parser.Name, cacheCommandUsage)
+		return ExitCodeUsage
+	}
+
+	config := DefaultProfileConfig()
+	if cacheArgs.ConfigPath != nil {
+		config, err = LoadConfigFromTOML(*cacheArgs.ConfigPath)
+		if err != nil {
+			log.Printf("Failed to load %s: %v", *cacheArgs.ConfigPath, err)
+			return ExitCodeError
+		}
+	}
+	if cacheArgs.CacheDirectory != nil {
+		config.CacheDirectory = *cacheArgs.CacheDirectory
+	}
+	if cacheArgs.MaxSize != nil {
+		config.CacheMaxSize = *cacheArgs.MaxSize
+	}
+	if cacheArgs.Verbose != nil {
+		config.Verbose = *cacheArgs.Verbose
+	}
+	cli.SetVerbosity(config.Verbose)
+	if config.CacheDirectory == "" {
+		log.Println("No cache directory passed")
+		return ExitCodeError
+	}
+	cli.logfVerbose("cache-dir=%s", config.CacheDirectory)
+
+	switch args[0] {
+	case "stats":
+		entries, err := ListCacheEntries(config.CacheDirectory)
+		if err != nil {
+			log.Println(err)
+			return ExitCodeError
+		}
+		writeCacheStats(os.Stdout, entries)
+	case "prune":
+		if cacheArgs.OlderThan == nil && config.CacheMaxSize == "" {
+			log.Println("prune requires --older-than, --max-size or cache-max-size in the configuration")
+			return ExitCodeUsage
+		}
+		if cacheArgs.OlderThan != nil {
+			olderThan, err := ParseTimeSpec(*cacheArgs.OlderThan, time.Now())
+			if err != nil {
+				log.Println(err)
+				return ExitCodeError
+			}
+			removed, err := PruneCache(config.CacheDirectory, olderThan)
+			cli.reportRemovedCacheEntries(removed)
+			if err != nil {
+				log.Println(err)
+				return ExitCodeError
+			}
+		}
+		if config.CacheMaxSize != "" {
+			maxSize, err := ParseByteSize(config.CacheMaxSize)
+			if err != nil {
+				log.Println(err)
+				return ExitCodeError
+			}
+			removed, err := EvictCache(config.CacheDirectory, maxSize)
+			cli.reportRemovedCacheEntries(removed)
+			if err != nil {
+				log.Println(err)
+				return ExitCodeError
+			}
+		}
+	case "clear":
+		removed, err := ClearCache(config.CacheDirectory)
+		cli.reportRemovedCacheEntries(removed)
+		if err != nil {
+			log.Println(err)
+			return ExitCodeError
+		}
+	default:
+		log.Printf("Unknown cache command: %s (usage: %s %s)", args[0], parser.Name, cacheCommandUsage)
+		return ExitCodeUsage
+	}
+	return ExitCodeOK
+}
+
+func (cli *CLI) reportRemovedCacheEntries(removed []*CacheEntry) {
+	var size int64
+	for _, entry := range removed {
+		cli.logfVerbose("Removed %s", entry.Path)
+		size += entry.Size
+	}
+	log.Printf("Removed %d cache entries (%s)", len(removed), FormatByteSize(size))
+}
+
+func writeCacheStats(w io.Writer, entries []*CacheEntry) {
+	stats, total := SummarizeCacheEntries(entries)
+	table := tablewriter.NewWriter(w)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeader([]string{"Host", "Repository", "Entries", "Size", "Oldest", "Newest"})
+	for _, s := range stats {
+		host := s.Host
+		if host == "" {
+			host = "(unknown)"
+		}
+		repository := s.Repository
+		if repository == "" {
+			repository = "(other requests)"
+		}
+		table.Append(cacheStatsRow(host, repository, s))
+	}
+	table.SetFooter(cacheStatsRow("Total", "-", total))
+	table.Render()
+}
+
+func cacheStatsRow(host, repository string, s *CacheStats) []string {
+	return []string{
+		host,
+		repository,
+		strconv.Itoa(s.Entries),
+		FormatByteSize(s.Size),
+		formatCacheTime(s.Oldest),
+		formatCacheTime(s.Newest),
+	}
+}
+
+func formatCacheTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
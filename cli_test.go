@@ -0,0 +1,45 @@
+package ghaprofiler
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_StartExitCode(t *testing.T) {
+	// silence usages and errors
+	stdout := os.Stdout
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	os.Stdout = devNull
+	log.SetOutput(ioutil.Discard)
+	defer func() {
+		os.Stdout = stdout
+		log.SetOutput(os.Stderr)
+	}()
+
+	testCases := []struct {
+		args     []string
+		expected int
+	}{
+		{args: []string{"--help"}, expected: ExitCodeOK},
+		{args: []string{"--unknown-option"}, expected: ExitCodeUsage},
+		{args: []string{"--owner", "owner", "--repository", "repo"}, expected: ExitCodeUsage},
+		{args: []string{"--owner", "owner", "--repository", "repo", "--workflow-file", "ci.yml", "--timeout", "5"}, expected: ExitCodeUsage},
+		{args: []string{"--owner", "owner", "--repository", "repo", "--workflow-file", "ci.yml", "--timeout=-1m"}, expected: ExitCodeUsage},
+		{args: []string{"--config", filepath.Join(os.TempDir(), "not-found.toml")}, expected: ExitCodeError},
+		{args: []string{"cache"}, expected: ExitCodeUsage},
+		{args: []string{"cache", "--cache-dir", os.TempDir(), "unknown"}, expected: ExitCodeUsage},
+	}
+	for _, tc := range testCases {
+		if got := NewCLI().Start(context.Background(), tc.args); got != tc.expected {
+			t.Errorf("%v: expected exit code %d, got %d", tc.args, tc.expected, got)
+		}
+	}
+}
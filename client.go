@@ -2,67 +2,156 @@ package ghaprofiler
 
 import (
 	"context"
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/google/go-github/v32/github"
 	"github.com/gregjones/httpcache"
-	"github.com/gregjones/httpcache/diskcache"
 	"golang.org/x/oauth2"
 )
 
 var userAgent = "github-actions-profiler (+https://github.com/utgwkk/github-actions-profiler)"
 
+const defaultAPIHost = "api.github.com"
+
 type Client struct {
 	githubClient *github.Client
+	// immutableCache is nil if cache is disabled
+	immutableCache *ImmutableCache
+	cacheObserver  CacheObserver
+	// logger is nil to use the standard logger
+	logger *log.Logger
 }
 
 type ClientConfig struct {
-	AccessToken    string
+	AccessToken string
+	// AppID, AppInstallationID and AppPrivateKey authenticate as a GitHub App installation
+	// instead of AccessToken if AppID is set
+	AppID             int64
+	AppInstallationID int64
+	AppPrivateKey     []byte
+	// BaseURL and UploadURL are set for GitHub Enterprise Server
+	BaseURL        string
+	UploadURL      string
 	Cache          bool
 	CacheDirectory string
+	MaxRetries     int
+	Verbose        bool
+	// Logger receives messages of retries and cache failures; the standard logger is used if nil
+	Logger *log.Logger
+	// ResponseObserver is notified of every response from the network if set
+	ResponseObserver ResponseObserver
+	// CacheObserver is notified of every response served from the cache if set
+	CacheObserver CacheObserver
 }
 
-func NewClientWithConfig(ctx context.Context, config *ClientConfig) *Client {
+func NewClientWithConfig(ctx context.Context, config *ClientConfig) (*Client, error) {
 	client := &Client{
 		githubClient: github.NewClient(nil),
 	}
 
 	if config == nil {
-		return client
-	}
-
-	var cacheTransport *httpcache.Transport
-	var oauth2Client *http.Client
-	if config.Cache {
-		diskCache := diskcache.New(config.CacheDirectory)
-		cacheTransport = httpcache.NewTransport(diskCache)
+		return client, nil
 	}
 
-	if config.AccessToken != "" {
+	// cache policy -> (HTTP cache) -> retry -> observer -> oauth2 -> network
+	var transport http.RoundTripper = http.DefaultTransport
+	if config.AppID != 0 {
+		apiBaseURL, err := config.apiBaseURL()
+		if err != nil {
+			return nil, err
+		}
+		ts, err := newAppTokenSource(config.AppID, config.AppInstallationID, config.AppPrivateKey, apiBaseURL)
+		if err != nil {
+			return nil, err
+		}
+		transport = oauth2.NewClient(ctx, ts).Transport
+	} else if config.AccessToken != "" {
 		ts := oauth2.StaticTokenSource(
 			&oauth2.Token{AccessToken: config.AccessToken},
 		)
-		oauth2Client = oauth2.NewClient(ctx, ts)
+		transport = oauth2.NewClient(ctx, ts).Transport
 	}
-
-	if oauth2Client != nil {
-		if cacheTransport != nil {
-			cacheTransport.Transport = oauth2Client.Transport
-			client.githubClient = github.NewClient(cacheTransport.Client())
-		} else {
-			client.githubClient = github.NewClient(oauth2Client)
+	if config.ResponseObserver != nil {
+		transport = &observingTransport{
+			Transport: transport,
+			Observer:  config.ResponseObserver,
 		}
-	} else {
-		if cacheTransport != nil {
-			client.githubClient = github.NewClient(cacheTransport.Client())
-		} else {
-			client.githubClient = github.NewClient(nil)
+	}
+	retry := newRetryTransport(transport, config.MaxRetries, config.Verbose)
+	retry.Logger = config.Logger
+	transport = retry
+	client.logger = config.Logger
+	if config.Cache {
+		cacheDirectory, err := config.hostCacheDirectory()
+		if err != nil {
+			return nil, err
+		}
+		cacheTransport := httpcache.NewTransport(newLRUDiskCache(cacheDirectory))
+		cacheTransport.Transport = transport
+		transport = &cachePolicyTransport{
+			Cache:     cacheTransport,
+			Transport: transport,
+			Observer:  config.CacheObserver,
 		}
+		client.immutableCache = NewImmutableCache(filepath.Join(cacheDirectory, immutableCacheDirectoryName))
+		client.cacheObserver = config.CacheObserver
 	}
 
+	httpClient := &http.Client{Transport: transport}
+	if config.BaseURL != "" {
+		uploadURL := config.UploadURL
+		if uploadURL == "" {
+			uploadURL = config.BaseURL
+		}
+		enterpriseClient, err := github.NewEnterpriseClient(config.BaseURL, uploadURL, httpClient)
+		if err != nil {
+			return nil, err
+		}
+		client.githubClient = enterpriseClient
+	} else {
+		client.githubClient = github.NewClient(httpClient)
+	}
 	client.githubClient.UserAgent = userAgent
 
-	return client
+	return client, nil
+}
+
+// APIHost returns the host name of the API endpoint
+func (config *ClientConfig) APIHost() (string, error) {
+	if config.BaseURL == "" {
+		return defaultAPIHost, nil
+	}
+	baseURL, err := url.Parse(config.BaseURL)
+	if err != nil {
+		return "", err
+	}
+	if baseURL.Host == "" {
+		return "", fmt.Errorf("Invalid base URL: %s", config.BaseURL)
+	}
+	return baseURL.Host, nil
+}
+
+// hostCacheDirectory namespaces the cache directory by API host so that entries never collide
+func (config *ClientConfig) hostCacheDirectory() (string, error) {
+	host, err := config.APIHost()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(config.CacheDirectory, strings.Replace(host, ":", "_", -1)), nil
+}
+
+func (c Client) logf(format string, args ...interface{}) {
+	if c.logger != nil {
+		c.logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
 }
 
 func (c Client) GetWorkflowJobByID(ctx context.Context, owner, repo string, jobID int64) (*github.WorkflowJob, *github.Response, error) {
@@ -73,6 +162,307 @@ func (c Client) ListWorkflowJobs(ctx context.Context, owner, repo string, runID
 	return c.githubClient.Actions.ListWorkflowJobs(ctx, owner, repo, runID, opts)
 }
 
+// GetWorkflowRunByID is Actions.GetWorkflowRunByID which also decodes the attempt of the workflow run
+func (c Client) GetWorkflowRunByID(ctx context.Context, owner, repo string, runID int64) (*WorkflowRun, *github.Response, error) {
+	req, err := c.githubClient.NewRequest("GET", fmt.Sprintf("repos/%s/%s/actions/runs/%d", owner, repo, runID), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	run := new(WorkflowRun)
+	resp, err := c.githubClient.Do(ctx, req, run)
+	if err != nil {
+		return nil, resp, err
+	}
+	return run, resp, nil
+}
+
+func (c Client) ListWorkflows(ctx context.Context, owner, repo string, opts *github.ListOptions) (*github.Workflows, *github.Response, error) {
+	return c.githubClient.Actions.ListWorkflows(ctx, owner, repo, opts)
+}
+
 func (c Client) ListWorkflowRunsByFileName(ctx context.Context, owner, repo, workflowFileName string, opts *github.ListWorkflowRunsOptions) (*github.WorkflowRuns, *github.Response, error) {
 	return c.githubClient.Actions.ListWorkflowRunsByFileName(ctx, owner, repo, workflowFileName, opts)
 }
+
+// listWorkflowRunsPageByFileName is ListWorkflowRunsByFileName which also decodes attempts of workflow runs
+func (c Client) listWorkflowRunsPageByFileName(ctx context.Context, owner, repo, workflowFileName string, opts *github.ListWorkflowRunsOptions) (*WorkflowRuns, *github.Response, error) {
+	query := url.Values{}
+	for key, value := range map[string]string{
+		"actor":  opts.Actor,
+		"branch": opts.Branch,
+		"event":  opts.Event,
+		"status": opts.Status,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	if opts.Page != 0 {
+		query.Set("page", strconv.Itoa(opts.Page))
+	}
+	if opts.PerPage != 0 {
+		query.Set("per_page", strconv.Itoa(opts.PerPage))
+	}
+	u := fmt.Sprintf("repos/%s/%s/actions/workflows/%s/runs?%s", owner, repo, workflowFileName, query.Encode())
+	req, err := c.githubClient.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	runs := new(WorkflowRuns)
+	resp, err := c.githubClient.Do(ctx, req, runs)
+	if err != nil {
+		return nil, resp, err
+	}
+	return runs, resp, nil
+}
+
+// maxPerPage is the maximum page size accepted by GitHub REST API
+const maxPerPage = 100
+
+// ListWorkflowRunsByFileNameWithLimit follows pagination until it collects limit workflow runs
+// which match filter, or there are no more runs. limit <= 0 collects every workflow run.
+func (c Client) ListWorkflowRunsByFileNameWithLimit(ctx context.Context, owner, repo, workflowFileName string, opts *github.ListWorkflowRunsOptions, filter *WorkflowRunFilter, limit int) ([]*WorkflowRun, error) {
+	return c.listWorkflowRunsByFileName(ctx, owner, repo, workflowFileName, opts, filter, limit, nil)
+}
+
+// ListNewWorkflowRunsByFileName is ListWorkflowRunsByFileNameWithLimit which also stops at the first known workflow run.
+// Workflow runs are listed from newest to oldest, so it returns workflow runs created after the known ones.
+func (c Client) ListNewWorkflowRunsByFileName(ctx context.Context, owner, repo, workflowFileName string, opts *github.ListWorkflowRunsOptions, filter *WorkflowRunFilter, limit int, isKnown func(*github.WorkflowRun) (bool, error)) ([]*WorkflowRun, error) {
+	return c.listWorkflowRunsByFileName(ctx, owner, repo, workflowFileName, opts, filter, limit, isKnown)
+}
+
+func (c Client) listWorkflowRunsByFileName(ctx context.Context, owner, repo, workflowFileName string, opts *github.ListWorkflowRunsOptions, filter *WorkflowRunFilter, limit int, isKnown func(*github.WorkflowRun) (bool, error)) ([]*WorkflowRun, error) {
+	// opts is copied so that pages do not change the caller's options
+	copied := github.ListWorkflowRunsOptions{}
+	if opts != nil {
+		copied = *opts
+	}
+	opts = &copied
+	// per_page must not change between pages, or page numbers point to other offsets
+	opts.PerPage = limit
+	if limit <= 0 || opts.PerPage > maxPerPage {
+		opts.PerPage = maxPerPage
+	}
+	var workflowRuns []*WorkflowRun
+	for limit <= 0 || len(workflowRuns) < limit {
+		runs, resp, err := c.listWorkflowRunsPageByFileName(ctx, owner, repo, workflowFileName, opts)
+		if err != nil {
+			return nil, err
+		}
+		reachedEnd := false
+		for _, run := range runs.WorkflowRuns {
+			if filter.IsBeforeRange(run.WorkflowRun) {
+				reachedEnd = true
+				break
+			}
+			if isKnown != nil {
+				known, err := isKnown(run.WorkflowRun)
+				if err != nil {
+					return nil, err
+				}
+				if known {
+					reachedEnd = true
+					break
+				}
+			}
+			if filter.Match(run.WorkflowRun) {
+				workflowRuns = append(workflowRuns, run)
+			}
+		}
+		if reachedEnd || resp.NextPage == 0 || len(runs.WorkflowRuns) == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	if limit > 0 && len(workflowRuns) > limit {
+		workflowRuns = workflowRuns[:limit]
+	}
+	return workflowRuns, nil
+}
+
+// ListAllWorkflowJobs follows pagination and returns every job of a workflow run.
+// When allAttempts is true, jobs of previous attempts are also returned.
+func (c Client) ListAllWorkflowJobs(ctx context.Context, owner, repo string, runID int64, allAttempts bool) ([]*github.WorkflowJob, error) {
+	opts := &github.ListWorkflowJobsOptions{
+		ListOptions: github.ListOptions{
+			PerPage: maxPerPage,
+		},
+	}
+	if allAttempts {
+		opts.Filter = "all"
+	}
+	var workflowJobs []*github.WorkflowJob
+	for {
+		jobs, resp, err := c.ListWorkflowJobs(ctx, owner, repo, runID, opts)
+		if err != nil {
+			return nil, err
+		}
+		workflowJobs = append(workflowJobs, jobs.Jobs...)
+		if resp.NextPage == 0 || len(jobs.Jobs) == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return workflowJobs, nil
+}
+
+// ListAllWorkflowJobsOfRun is ListAllWorkflowJobs which serves jobs of a completed workflow run
+// from the immutable cache without any request
+func (c Client) ListAllWorkflowJobsOfRun(ctx context.Context, owner, repo string, run *github.WorkflowRun, allAttempts bool) ([]*github.WorkflowJob, error) {
+	if c.immutableCache == nil || run.GetStatus() != "completed" {
+		return c.ListAllWorkflowJobs(ctx, owner, repo, run.GetID(), allAttempts)
+	}
+
+	key := workflowJobsCacheKey(owner, repo, run, allAttempts)
+	var cachedJobs []*github.WorkflowJob
+	if ok, err := c.immutableCache.Get(key, &cachedJobs); err != nil {
+		c.logf("Failed to read jobs of workflow run %d from the cache: %v", run.GetID(), err)
+	} else if ok {
+		if c.cacheObserver != nil {
+			c.cacheObserver.ObserveCacheHit()
+		}
+		return cachedJobs, nil
+	}
+
+	jobs, err := c.ListAllWorkflowJobs(ctx, owner, repo, run.GetID(), allAttempts)
+	if err != nil {
+		return nil, err
+	}
+	if isImmutableWorkflowRun(run, jobs) {
+		// the cache is an optimization, so the fetched jobs are returned even if they are not stored
+		if err := c.immutableCache.Set(key, jobs); err != nil {
+			c.logf("Failed to store jobs of workflow run %d to the cache: %v", run.GetID(), err)
+		}
+	}
+	return jobs, nil
+}
+
+// ListAllWorkflows follows pagination and returns every workflow of a repository
+func (c Client) ListAllWorkflows(ctx context.Context, owner, repo string) ([]*github.Workflow, error) {
+	opts := &github.ListOptions{
+		PerPage: maxPerPage,
+	}
+	var workflows []*github.Workflow
+	for {
+		page, resp, err := c.ListWorkflows(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		workflows = append(workflows, page.Workflows...)
+		if resp.NextPage == 0 || len(page.Workflows) == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return workflows, nil
+}
+
+// ListAllRepositoriesByOwner follows pagination and returns every repository of an organization or a user
+func (c Client) ListAllRepositoriesByOwner(ctx context.Context, owner string) ([]*github.Repository, error) {
+	var repositories []*github.Repository
+
+	orgOpts := &github.RepositoryListByOrgOptions{
+		ListOptions: github.ListOptions{
+			PerPage: maxPerPage,
+		},
+	}
+	for {
+		repos, resp, err := c.githubClient.Repositories.ListByOrg(ctx, owner, orgOpts)
+		if err != nil {
+			if isNotFoundError(err) {
+				// owner is not an organization but a user
+				break
+			}
+			return nil, err
+		}
+		repositories = append(repositories, repos...)
+		if resp.NextPage == 0 || len(repos) == 0 {
+			return repositories, nil
+		}
+		orgOpts.Page = resp.NextPage
+	}
+
+	userOpts := &github.RepositoryListOptions{
+		ListOptions: github.ListOptions{
+			PerPage: maxPerPage,
+		},
+	}
+	for {
+		repos, resp, err := c.githubClient.Repositories.List(ctx, owner, userOpts)
+		if err != nil {
+			return nil, err
+		}
+		repositories = append(repositories, repos...)
+		if resp.NextPage == 0 || len(repos) == 0 {
+			break
+		}
+		userOpts.Page = resp.NextPage
+	}
+	return repositories, nil
+}
+
+// GetWorkflowFileRevision returns the blob SHA of the workflow file at the commit, or an empty string
+// if the file does not exist at the commit. It is served from the immutable cache without any request if cached.
+func (c Client) GetWorkflowFileRevision(ctx context.Context, owner, repo, workflowFileName, commitSHA string) (string, error) {
+	key := workflowRevisionCacheKey(owner, repo, workflowFileName, commitSHA)
+	if c.immutableCache != nil {
+		var revision string
+		if ok, err := c.immutableCache.Get(key, &revision); err != nil {
+			c.logf("Failed to read the revision of %s at %s from the cache: %v", workflowFileName, commitSHA, err)
+		} else if ok {
+			if c.cacheObserver != nil {
+				c.cacheObserver.ObserveCacheHit()
+			}
+			return revision, nil
+		}
+	}
+
+	var revision string
+	fileContent, _, _, err := c.githubClient.Repositories.GetContents(ctx, owner, repo, workflowFilePath(workflowFileName), &github.RepositoryContentGetOptions{Ref: commitSHA})
+	if err != nil {
+		if !isNotFoundError(err) {
+			return "", err
+		}
+	} else if fileContent != nil {
+		revision = fileContent.GetSHA()
+	}
+	if c.immutableCache != nil {
+		if err := c.immutableCache.Set(key, revision); err != nil {
+			c.logf("Failed to store the revision of %s at %s to the cache: %v", workflowFileName, commitSHA, err)
+		}
+	}
+	return revision, nil
+}
+
+// GetWorkflowFileContent returns the content of a revision of a workflow file.
+// It is served from the immutable cache without any request if cached.
+func (c Client) GetWorkflowFileContent(ctx context.Context, owner, repo, revision string) ([]byte, error) {
+	key := workflowFileContentCacheKey(owner, repo, revision)
+	if c.immutableCache != nil {
+		var content []byte
+		if ok, err := c.immutableCache.Get(key, &content); err != nil {
+			c.logf("Failed to read the workflow file of revision %s from the cache: %v", revision, err)
+		} else if ok {
+			if c.cacheObserver != nil {
+				c.cacheObserver.ObserveCacheHit()
+			}
+			return content, nil
+		}
+	}
+
+	content, _, err := c.githubClient.Git.GetBlobRaw(ctx, owner, repo, revision)
+	if err != nil {
+		return nil, err
+	}
+	if c.immutableCache != nil {
+		if err := c.immutableCache.Set(key, content); err != nil {
+			c.logf("Failed to store the workflow file of revision %s to the cache: %v", revision, err)
+		}
+	}
+	return content, nil
+}
+
+func isNotFoundError(err error) bool {
+	errorResponse, ok := err.(*github.ErrorResponse)
+	return ok && errorResponse.Response != nil && errorResponse.Response.StatusCode == http.StatusNotFound
+}
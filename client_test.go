@@ -0,0 +1,190 @@
+package ghaprofiler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-github/v32/github"
+)
+
+func newTestClient(t *testing.T, handler http.Handler) (*Client, func()) {
+	server := httptest.NewServer(handler)
+
+	githubClient := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	githubClient.BaseURL = baseURL
+	return &Client{githubClient: githubClient}, server.Close
+}
+
+func Test_ListWorkflowRunsByFileNameWithLimit(t *testing.T) {
+	const totalRuns = 250
+	client, teardown := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		if perPage != maxPerPage {
+			t.Errorf("per_page must be %d, got %d", maxPerPage, perPage)
+		}
+		var runs []*github.WorkflowRun
+		for i := (page - 1) * perPage; i < page*perPage && i < totalRuns; i++ {
+			runs = append(runs, &github.WorkflowRun{ID: github.Int64(int64(i))})
+		}
+		if page*perPage < totalRuns {
+			w.Header().Set("Link", fmt.Sprintf(`<%s?page=%d&per_page=%d>; rel="next"`, r.URL.Path, page+1, perPage))
+		}
+		json.NewEncoder(w).Encode(&github.WorkflowRuns{WorkflowRuns: runs})
+	}))
+	defer teardown()
+
+	runs, err := client.ListWorkflowRunsByFileNameWithLimit(context.Background(), "owner", "repo", "ci.yml", nil, nil, 150)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 150 {
+		t.Fatalf("expected 150 runs, got %d", len(runs))
+	}
+	for i, run := range runs {
+		if *run.ID != int64(i) {
+			t.Fatalf("runs[%d] has unexpected ID %d", i, *run.ID)
+		}
+	}
+
+	// the same options are reused for each limit
+	opts := &github.ListWorkflowRunsOptions{Branch: "main"}
+	for _, limit := range []int{1000, 0} {
+		runs, err = client.ListWorkflowRunsByFileNameWithLimit(context.Background(), "owner", "repo", "ci.yml", opts, nil, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(runs) != totalRuns {
+			t.Fatalf("limit %d: expected %d runs, got %d", limit, totalRuns, len(runs))
+		}
+		if opts.Page != 0 || opts.PerPage != 0 || opts.Branch != "main" {
+			t.Fatalf("options are modified: %+v", opts)
+		}
+	}
+}
+
+func Test_ListAllWorkflowJobs(t *testing.T) {
+	const totalJobs = 130
+	var filter string
+	client, teardown := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter = r.URL.Query().Get("filter")
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		var jobs []*github.WorkflowJob
+		for i := (page - 1) * perPage; i < page*perPage && i < totalJobs; i++ {
+			jobs = append(jobs, &github.WorkflowJob{ID: github.Int64(int64(i))})
+		}
+		if page*perPage < totalJobs {
+			w.Header().Set("Link", fmt.Sprintf(`<%s?page=%d&per_page=%d>; rel="next"`, r.URL.Path, page+1, perPage))
+		}
+		json.NewEncoder(w).Encode(&github.Jobs{Jobs: jobs})
+	}))
+	defer teardown()
+
+	jobs, err := client.ListAllWorkflowJobs(context.Background(), "owner", "repo", 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != totalJobs {
+		t.Fatalf("expected %d jobs, got %d", totalJobs, len(jobs))
+	}
+	if filter != "" {
+		t.Fatalf("unexpected filter %#v", filter)
+	}
+
+	_, err = client.ListAllWorkflowJobs(context.Background(), "owner", "repo", 1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter != "all" {
+		t.Fatalf("expected filter=all, got %#v", filter)
+	}
+}
+
+func Test_NewClientWithConfig_Enterprise(t *testing.T) {
+	client, err := NewClientWithConfig(context.Background(), &ClientConfig{
+		BaseURL: "https://github.example.com/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.githubClient.BaseURL.String() != "https://github.example.com/api/v3/" {
+		t.Fatalf("unexpected base URL: %s", client.githubClient.BaseURL)
+	}
+	if client.githubClient.UploadURL.String() != "https://github.example.com/api/uploads/" {
+		t.Fatalf("unexpected upload URL: %s", client.githubClient.UploadURL)
+	}
+}
+
+func Test_ClientConfig_HostCacheDirectory(t *testing.T) {
+	testCases := []struct {
+		config   *ClientConfig
+		expected string
+	}{
+		{&ClientConfig{CacheDirectory: "/tmp/cache"}, "/tmp/cache/api.github.com"},
+		{&ClientConfig{CacheDirectory: "/tmp/cache", BaseURL: "https://github.example.com/api/v3/"}, "/tmp/cache/github.example.com"},
+		{&ClientConfig{CacheDirectory: "/tmp/cache", BaseURL: "http://localhost:8080/api/v3/"}, "/tmp/cache/localhost_8080"},
+	}
+	for _, tc := range testCases {
+		got, err := tc.config.hostCacheDirectory()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.expected {
+			t.Fatalf("expected %s, got %s", tc.expected, got)
+		}
+	}
+}
+
+func Test_ListWorkflowRunsByFileNameWithAttempts(t *testing.T) {
+	client, teardown := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/owner/repo/actions/runs/2" {
+			fmt.Fprint(w, `{"id": 2, "run_attempt": 2, "run_started_at": "2020-12-01T11:00:00Z"}`)
+			return
+		}
+		if branch := r.URL.Query().Get("branch"); branch != "main" {
+			t.Errorf("unexpected branch: %s", branch)
+		}
+		fmt.Fprint(w, `{"total_count": 2, "workflow_runs": [
+			{"id": 2, "run_attempt": 2, "created_at": "2020-12-01T10:00:00Z", "run_started_at": "2020-12-01T11:00:00Z"},
+			{"id": 1, "created_at": "2020-12-01T09:00:00Z"}
+		]}`)
+	}))
+	defer teardown()
+
+	opts := &github.ListWorkflowRunsOptions{Branch: "main"}
+	runs, err := client.ListWorkflowRunsByFileNameWithLimit(context.Background(), "owner", "repo", "ci.yml", opts, nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].GetID() != 2 || runs[0].RunAttempt != 2 || runs[0].RunStartedAt.Hour() != 11 {
+		t.Fatalf("unexpected runs: %+v", runs)
+	}
+	if runs[1].RunAttempt != 0 || runs[1].RunStartedAt != nil {
+		t.Fatalf("unexpected attempt of run 1: %+v", runs[1].WorkflowRunAttempt)
+	}
+
+	run, _, err := client.GetWorkflowRunByID(context.Background(), "owner", "repo", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.GetID() != 2 || run.RunAttempt != 2 || run.RunStartedAt == nil {
+		t.Fatalf("unexpected run: %+v", run)
+	}
+}
@@ -2,13 +2,31 @@ package main
 
 import (
 	"context"
+	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	ghaprofiler "github.com/utgwkk/github-actions-profiler"
 )
 
 func main() {
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// the first signal cancels in-flight requests so that workflow runs fetched so far are profiled,
+	// and the second one exits immediately
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Println("Interrupted; press Ctrl-C again to exit immediately")
+		cancel()
+		<-signals
+		os.Exit(130)
+	}()
+
 	cli := ghaprofiler.NewCLI()
-	cli.Start(ctx, os.Args[1:])
+	code := cli.Start(ctx, os.Args[1:])
+	cancel()
+	os.Exit(code)
 }
@@ -0,0 +1,198 @@
+package ghaprofiler
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ConcurrencyLimiter limits the number of concurrent requests
+type ConcurrencyLimiter interface {
+	Acquire(ctx context.Context) error
+	Release()
+}
+
+// ResponseObserver is notified of every response from GitHub API
+type ResponseObserver interface {
+	ObserveResponse(resp *http.Response, latency time.Duration)
+}
+
+// ResponseObservers notifies each of observers
+type ResponseObservers []ResponseObserver
+
+func (observers ResponseObservers) ObserveResponse(resp *http.Response, latency time.Duration) {
+	for _, observer := range observers {
+		observer.ObserveResponse(resp, latency)
+	}
+}
+
+type fixedConcurrencyLimiter chan struct{}
+
+func NewFixedConcurrencyLimiter(concurrency int) ConcurrencyLimiter {
+	return make(fixedConcurrencyLimiter, concurrency)
+}
+
+func (l fixedConcurrencyLimiter) Acquire(ctx context.Context) error {
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l fixedConcurrencyLimiter) Release() {
+	<-l
+}
+
+const (
+	// decrease concurrency when latency gets worse than this ratio of the best latency
+	adaptiveLatencyThreshold = 2.0
+	// decrease concurrency when the remaining rate limit gets lower than this ratio
+	adaptiveRateLimitThreshold = 0.1
+)
+
+// AdaptiveConcurrencyLimiter changes concurrency by observing responses.
+// It increases concurrency additively while responses are healthy,
+// and decreases it multiplicatively on secondary rate limits, poor latency or a low rate limit budget.
+type AdaptiveConcurrencyLimiter struct {
+	mu          sync.Mutex
+	limit       float64
+	maxLimit    int
+	inFlight    int
+	bestLatency time.Duration
+	changed     chan struct{}
+	verbose     bool
+}
+
+func NewAdaptiveConcurrencyLimiter(initial, max int, verbose bool) *AdaptiveConcurrencyLimiter {
+	if initial > max {
+		initial = max
+	}
+	return &AdaptiveConcurrencyLimiter{
+		limit:    float64(initial),
+		maxLimit: max,
+		changed:  make(chan struct{}),
+		verbose:  verbose,
+	}
+}
+
+// Limit returns current concurrency
+func (l *AdaptiveConcurrencyLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+func (l *AdaptiveConcurrencyLimiter) Acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inFlight < int(l.limit) {
+			l.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *AdaptiveConcurrencyLimiter) Release() {
+	l.mu.Lock()
+	l.inFlight--
+	l.notify()
+	l.mu.Unlock()
+}
+
+// notify wakes up goroutines waiting in Acquire. l.mu must be held.
+func (l *AdaptiveConcurrencyLimiter) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+func (l *AdaptiveConcurrencyLimiter) ObserveResponse(resp *http.Response, latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	before := int(l.limit)
+	switch {
+	case isSecondaryRateLimited(resp):
+		l.limit /= 2
+	case isRateLimitBudgetLow(resp):
+		l.limit /= 2
+	case resp.StatusCode >= 500:
+		l.limit /= 2
+	case l.bestLatency > 0 && float64(latency) > float64(l.bestLatency)*adaptiveLatencyThreshold:
+		l.limit -= 1
+	default:
+		l.limit += 1 / l.limit
+	}
+	if l.bestLatency == 0 || latency < l.bestLatency {
+		l.bestLatency = latency
+	}
+
+	if l.limit < 1 {
+		l.limit = 1
+	}
+	if l.limit > float64(l.maxLimit) {
+		l.limit = float64(l.maxLimit)
+	}
+	if after := int(l.limit); after != before {
+		if l.verbose {
+			log.Printf("Concurrency: %d -> %d", before, after)
+		}
+		l.notify()
+	}
+}
+
+func isSecondaryRateLimited(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return false
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "" {
+		return true
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		// primary rate limit
+		return false
+	}
+	isSecondaryRateLimit, _ := responseBodyContains(resp, "secondary rate limit", "abuse detection")
+	return isSecondaryRateLimit
+}
+
+func isRateLimitBudgetLow(resp *http.Response) bool {
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return false
+	}
+	limit, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	if err != nil || limit <= 0 {
+		return false
+	}
+	return float64(remaining) < float64(limit)*adaptiveRateLimitThreshold
+}
+
+// observingTransport notifies Observer of every response and its latency
+type observingTransport struct {
+	Transport http.RoundTripper
+	Observer  ResponseObserver
+}
+
+func (t *observingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	t.Observer.ObserveResponse(resp, time.Since(start))
+	return resp, nil
+}
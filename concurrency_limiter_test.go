@@ -0,0 +1,87 @@
+package ghaprofiler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newTestResponse(statusCode int, headers map[string]string) *http.Response {
+	resp := &http.Response{
+		StatusCode: statusCode,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+	}
+	for k, v := range headers {
+		resp.Header.Set(k, v)
+	}
+	return resp
+}
+
+func Test_AdaptiveConcurrencyLimiter_Increase(t *testing.T) {
+	limiter := NewAdaptiveConcurrencyLimiter(2, 4, false)
+	for i := 0; i < 100; i++ {
+		limiter.ObserveResponse(newTestResponse(http.StatusOK, map[string]string{
+			"X-RateLimit-Remaining": "4000",
+			"X-RateLimit-Limit":     "5000",
+		}), 100*time.Millisecond)
+	}
+	if limiter.Limit() != 4 {
+		t.Fatalf("expected concurrency to reach the ceiling 4, got %d", limiter.Limit())
+	}
+}
+
+func Test_AdaptiveConcurrencyLimiter_Decrease(t *testing.T) {
+	limiter := NewAdaptiveConcurrencyLimiter(8, 8, false)
+	limiter.ObserveResponse(newTestResponse(http.StatusForbidden, map[string]string{
+		"Retry-After": "60",
+	}), 100*time.Millisecond)
+	if limiter.Limit() != 4 {
+		t.Fatalf("expected concurrency 4 after a secondary rate limit, got %d", limiter.Limit())
+	}
+
+	limiter.ObserveResponse(newTestResponse(http.StatusOK, map[string]string{
+		"X-RateLimit-Remaining": "100",
+		"X-RateLimit-Limit":     "5000",
+	}), 100*time.Millisecond)
+	if limiter.Limit() != 2 {
+		t.Fatalf("expected concurrency 2 with a low rate limit budget, got %d", limiter.Limit())
+	}
+
+	limiter.ObserveResponse(newTestResponse(http.StatusOK, nil), time.Second)
+	if limiter.Limit() != 1 {
+		t.Fatalf("expected concurrency 1 with poor latency, got %d", limiter.Limit())
+	}
+
+	limiter.ObserveResponse(newTestResponse(http.StatusBadGateway, nil), 100*time.Millisecond)
+	if limiter.Limit() != 1 {
+		t.Fatalf("concurrency must not be lower than 1, got %d", limiter.Limit())
+	}
+}
+
+func Test_AdaptiveConcurrencyLimiter_Acquire(t *testing.T) {
+	limiter := NewAdaptiveConcurrencyLimiter(1, 2, false)
+	ctx := context.Background()
+	if err := limiter.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Acquire(timeoutCtx); err == nil {
+		t.Fatal("Acquire must block while concurrency is exhausted")
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		limiter.Acquire(ctx)
+		close(acquired)
+	}()
+	limiter.Release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Acquire must return after Release")
+	}
+}
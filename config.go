@@ -3,28 +3,65 @@ package ghaprofiler
 import (
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path"
 	"regexp"
+	"strings"
+	"time"
 
+	"github.com/google/go-github/v32/github"
 	"github.com/pelletier/go-toml"
 )
 
 type ProfileConfig struct {
-	Owner            string        `toml:"owner"`
-	Repository       string        `toml:"repository"`
-	WorkflowFileName string        `toml:"workflow-file"`
-	Cache            bool          `toml:"cache"`
-	CacheDirectory   string        `toml:"cache-directory"`
-	Concurrency      int           `toml:"concurrency"`
-	NumberOfJob      int           `toml:"number-of-job"`
-	AccessToken      string        `toml:"access-token"`
-	Format           string        `toml:"format"`
-	SortBy           string        `toml:"sort"`
-	Reverse          bool          `toml:"reverse"`
-	Verbose          bool          `toml:"verbose"`
-	JobNameRegexp    string        `toml:"job-name-regexp"`
-	Replace          []replaceRule `toml:"replace_rule"`
+	Owner               string        `toml:"owner"`
+	Repository          string        `toml:"repository"`
+	Repositories        []string      `toml:"repositories"`
+	Remote              string        `toml:"remote"`
+	DiscoverOwner       string        `toml:"discover-owner"`
+	WorkflowFileName    string        `toml:"workflow-file"`
+	WorkflowFiles       []string      `toml:"workflow-files"`
+	AllWorkflows        bool          `toml:"all-workflows"`
+	Cache               bool          `toml:"cache"`
+	CacheDirectory      string        `toml:"cache-directory"`
+	CacheMaxSize        string        `toml:"cache-max-size"`
+	Concurrency         int           `toml:"concurrency"`
+	AdaptiveConcurrency bool          `toml:"adaptive-concurrency"`
+	MaxConcurrency      int           `toml:"max-concurrency"`
+	MaxRetries          int           `toml:"max-retries"`
+	Timeout             string        `toml:"timeout"`
+	NumberOfJob         int           `toml:"number-of-job"`
+	AccessToken         string        `toml:"access-token"`
+	AppID               int64         `toml:"app-id"`
+	AppInstallationID   int64         `toml:"app-installation-id"`
+	AppPrivateKeyPath   string        `toml:"app-private-key"`
+	BaseURL             string        `toml:"base-url"`
+	UploadURL           string        `toml:"upload-url"`
+	EnterpriseHosts     []string      `toml:"enterprise-hosts"`
+	AllAttempts         bool          `toml:"all-attempts"`
+	Format              string        `toml:"format"`
+	SortBy              string        `toml:"sort"`
+	Reverse             bool          `toml:"reverse"`
+	Verbose             bool          `toml:"verbose"`
+	Quiet               bool          `toml:"quiet"`
+	Record              string        `toml:"record"`
+	Inputs              []string      `toml:"input"`
+	Database            string        `toml:"database"`
+	JobNameRegexp       string        `toml:"job-name-regexp"`
+	Branch              string        `toml:"branch"`
+	Event               string        `toml:"event"`
+	Status              string        `toml:"status"`
+	Conclusion          string        `toml:"conclusion"`
+	Actor               string        `toml:"actor"`
+	Since               string        `toml:"since"`
+	Until               string        `toml:"until"`
+	Replace             []replaceRule `toml:"replace_rule"`
+	IncludeSkippedSteps bool          `toml:"include-skipped-steps"`
+	StepKey             string        `toml:"step-key"`
+	GroupByRevision     bool          `toml:"group-by-revision"`
+	Revisions           []string      `toml:"revision"`
+	Levels              []string      `toml:"level"`
 }
 
 var defaultCacheDirectoryName = "github-actions-profiler-httpcache"
@@ -42,27 +79,63 @@ func defaultCacheDirectoryPath() string {
 func DefaultProfileConfig() *ProfileConfig {
 	return &ProfileConfig{
 		Concurrency:    2,
+		MaxConcurrency: 10,
+		MaxRetries:     defaultMaxRetries,
 		NumberOfJob:    20,
 		Cache:          true,
 		CacheDirectory: defaultCacheDirectoryPath(),
+		Database:       defaultDatabasePath(),
 		Format:         "table",
+		Remote:         "origin",
 		SortBy:         "number",
+		StepKey:        StepKeyNumber,
 	}
 }
 
 func (config ProfileConfig) Validate() error {
-	if config.Owner == "" {
-		return fmt.Errorf("Repository owner name required")
+	return config.validate(config.IsOffline())
+}
+
+// validate validates config, where offline is whether workflow runs are given instead of being fetched
+func (config ProfileConfig) validate(offline bool) error {
+	if !config.IsMultiRepository() && !offline {
+		if config.Owner == "" {
+			return fmt.Errorf("Repository owner name required")
+		}
+		if config.Repository == "" {
+			return fmt.Errorf("Repository name required")
+		}
 	}
-	if config.Repository == "" {
-		return fmt.Errorf("Repository name required")
+	for _, repository := range config.Repositories {
+		if _, err := ParseRepositoryName(repository); err != nil {
+			return err
+		}
 	}
-	if config.WorkflowFileName == "" {
+	if len(config.WorkflowFilePatterns()) == 0 && !config.AllWorkflows && !offline {
 		return fmt.Errorf("Workflow file name required")
 	}
+	for _, pattern := range config.WorkflowFilePatterns() {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid workflow file pattern: %s", pattern)
+		}
+	}
+	if config.Quiet && config.Verbose {
+		return fmt.Errorf("Quiet and Verbose cannot be enabled together")
+	}
 	if config.Concurrency <= 0 {
 		return fmt.Errorf("Concurrency must be a positive integer")
 	}
+	if config.AdaptiveConcurrency && config.MaxConcurrency < config.Concurrency {
+		return fmt.Errorf("MaxConcurrency must be greater than or equal to Concurrency")
+	}
+	if config.MaxRetries < 0 {
+		return fmt.Errorf("MaxRetries must not be negative")
+	}
+	if config.Timeout != "" {
+		if timeout, err := time.ParseDuration(config.Timeout); err != nil || timeout <= 0 {
+			return fmt.Errorf("Invalid timeout: %s", config.Timeout)
+		}
+	}
 	if config.NumberOfJob <= 0 {
 		return fmt.Errorf("NumberOfJob must be a positive integer")
 	}
@@ -72,9 +145,60 @@ func (config ProfileConfig) Validate() error {
 	if !IsValidSortFieldName(config.SortBy) {
 		return fmt.Errorf("Invalid sort field name: %s", config.SortBy)
 	}
+	if !IsValidStepKey(config.StepKey) {
+		return fmt.Errorf("Invalid step key: %s", config.StepKey)
+	}
+	for _, revision := range config.Revisions {
+		if !IsValidRevision(revision) {
+			return fmt.Errorf("Invalid revision: %s", revision)
+		}
+	}
+	for _, level := range config.Levels {
+		if !IsValidLevel(level) {
+			return fmt.Errorf("Invalid level: %s", level)
+		}
+	}
 	if _, err := regexp.Compile(config.JobNameRegexp); err != nil {
 		return fmt.Errorf("Invalid regular expression: %v", err)
 	}
+	if config.Status != "" && !IsValidRunStatus(config.Status) {
+		return fmt.Errorf("Invalid status: %s", config.Status)
+	}
+	if config.Conclusion != "" && !IsValidRunConclusion(config.Conclusion) {
+		return fmt.Errorf("Invalid conclusion: %s", config.Conclusion)
+	}
+	if _, err := config.WorkflowRunFilter(time.Now()); err != nil {
+		return err
+	}
+	if config.BaseURL != "" {
+		if u, err := url.Parse(config.BaseURL); err != nil || u.Host == "" {
+			return fmt.Errorf("Invalid base URL: %s", config.BaseURL)
+		}
+	}
+	if config.UploadURL != "" {
+		if u, err := url.Parse(config.UploadURL); err != nil || u.Host == "" {
+			return fmt.Errorf("Invalid upload URL: %s", config.UploadURL)
+		}
+	}
+	for _, host := range config.EnterpriseHosts {
+		if host == "" || strings.ContainsAny(host, ":/") {
+			return fmt.Errorf("Invalid enterprise host: %s", host)
+		}
+	}
+	if config.AppID < 0 || config.AppInstallationID < 0 {
+		return fmt.Errorf("AppID and AppInstallationID must be positive integers")
+	}
+	if config.AppID != 0 && (config.AppInstallationID == 0 || config.AppPrivateKeyPath == "") {
+		return fmt.Errorf("GitHub App authentication requires app-installation-id and app-private-key")
+	}
+	if config.AppID == 0 && (config.AppInstallationID != 0 || config.AppPrivateKeyPath != "") {
+		return fmt.Errorf("GitHub App authentication requires app-id")
+	}
+	if config.CacheMaxSize != "" {
+		if _, err := ParseByteSize(config.CacheMaxSize); err != nil {
+			return err
+		}
+	}
 	if config.Cache && config.CacheDirectory == "" {
 		return fmt.Errorf("Cache enabled but no cache directory passed")
 	}
@@ -82,6 +206,116 @@ func (config ProfileConfig) Validate() error {
 	return nil
 }
 
+// IsMultiRepository reports whether repositories are passed with repositories or discover-owner
+// instead of owner and repository
+func (config ProfileConfig) IsMultiRepository() bool {
+	return len(config.Repositories) > 0 || config.DiscoverOwner != ""
+}
+
+// HasLevel reports whether profiles of the level are output.
+// Every level is output if no level is passed.
+func (config ProfileConfig) HasLevel(level string) bool {
+	if len(config.Levels) == 0 {
+		return true
+	}
+	for _, l := range config.Levels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOffline reports whether workflow runs are loaded from input files instead of GitHub
+func (config ProfileConfig) IsOffline() bool {
+	return len(config.Inputs) > 0
+}
+
+// UsesRevisions reports whether revisions of workflow files are resolved for workflow runs
+func (config ProfileConfig) UsesRevisions() bool {
+	return config.GroupByRevision || len(config.Revisions) > 0
+}
+
+// WorkflowFilePatterns returns workflow file names or glob patterns to profile
+func (config ProfileConfig) WorkflowFilePatterns() []string {
+	var patterns []string
+	if config.WorkflowFileName != "" {
+		patterns = append(patterns, config.WorkflowFileName)
+	}
+	return append(patterns, config.WorkflowFiles...)
+}
+
+// ListWorkflowRunsOptions returns options for the filters which the API supports
+func (config ProfileConfig) ListWorkflowRunsOptions() *github.ListWorkflowRunsOptions {
+	opts := &github.ListWorkflowRunsOptions{
+		Actor:  config.Actor,
+		Branch: config.Branch,
+		Event:  config.Event,
+		Status: config.Status,
+	}
+	if opts.Status == "" {
+		opts.Status = config.Conclusion
+	}
+	return opts
+}
+
+// syncFilter identifies the filters of workflow runs which a sync lists, except since and until
+func (config ProfileConfig) syncFilter() string {
+	values := url.Values{}
+	for name, value := range map[string]string{
+		"actor":      config.Actor,
+		"branch":     config.Branch,
+		"event":      config.Event,
+		"status":     config.Status,
+		"conclusion": config.Conclusion,
+	} {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	return values.Encode()
+}
+
+// WorkflowRunFilter returns a filter applied to workflow runs on the client side
+func (config ProfileConfig) WorkflowRunFilter(now time.Time) (*WorkflowRunFilter, error) {
+	filter := &WorkflowRunFilter{
+		Branch:     config.Branch,
+		Event:      config.Event,
+		Status:     config.Status,
+		Conclusion: config.Conclusion,
+	}
+	if config.Since != "" {
+		since, err := ParseTimeSpec(config.Since, now)
+		if err != nil {
+			return nil, err
+		}
+		filter.Since = since
+	}
+	if config.Until != "" {
+		until, err := ParseUntilTimeSpec(config.Until, now)
+		if err != nil {
+			return nil, err
+		}
+		filter.Until = until
+	}
+	if !filter.Since.IsZero() && !filter.Until.IsZero() && filter.Since.After(filter.Until) {
+		return nil, fmt.Errorf("since must be before until")
+	}
+	return filter, nil
+}
+
+// clone returns a copy of config which shares no slices with it, so that options do not modify config
+func (config ProfileConfig) clone() *ProfileConfig {
+	config.Repositories = append([]string(nil), config.Repositories...)
+	config.EnterpriseHosts = append([]string(nil), config.EnterpriseHosts...)
+	config.WorkflowFiles = append([]string(nil), config.WorkflowFiles...)
+	config.Inputs = append([]string(nil), config.Inputs...)
+	config.Replace = append([]replaceRule(nil), config.Replace...)
+	config.Revisions = append([]string(nil), config.Revisions...)
+	config.Levels = append([]string(nil), config.Levels...)
+	return &config
+}
+
 func LoadConfigFromTOML(filename string) (*ProfileConfig, error) {
 	config := DefaultProfileConfig()
 
@@ -109,11 +343,19 @@ func LoadConfigFromTOML(filename string) (*ProfileConfig, error) {
 func (c ProfileConfig) Dump() string {
 	var dump string
 	dump += fmt.Sprintf("concurrency=%v\n", c.Concurrency)
+	dump += fmt.Sprintf("adaptive-concurrency=%v\n", c.AdaptiveConcurrency)
+	dump += fmt.Sprintf("max-concurrency=%v\n", c.MaxConcurrency)
+	dump += fmt.Sprintf("max-retries=%v\n", c.MaxRetries)
+	dump += fmt.Sprintf("timeout=%v\n", c.Timeout)
 	dump += fmt.Sprintf("number-of-job=%v\n", c.NumberOfJob)
 	dump += fmt.Sprintf("format=%v\n", c.Format)
 	dump += fmt.Sprintf("job-name-regexp=%v\n", c.JobNameRegexp)
 	dump += fmt.Sprintf("owner=%v\n", c.Owner)
 	dump += fmt.Sprintf("repo=%v\n", c.Repository)
+	dump += fmt.Sprintf("repositories=%v\n", c.Repositories)
+	dump += fmt.Sprintf("remote=%v\n", c.Remote)
+	dump += fmt.Sprintf("discover-owner=%v\n", c.DiscoverOwner)
+	dump += fmt.Sprintf("quiet=%v\n", c.Quiet)
 	dump += fmt.Sprintf("reverse=%v\n", c.Reverse)
 	dump += fmt.Sprintf("sort=%v\n", c.SortBy)
 	// We don't write out token
@@ -122,9 +364,34 @@ func (c ProfileConfig) Dump() string {
 	} else {
 		dump += "access token set\n"
 	}
+	dump += fmt.Sprintf("app-id=%v\n", c.AppID)
+	dump += fmt.Sprintf("app-installation-id=%v\n", c.AppInstallationID)
+	dump += fmt.Sprintf("app-private-key=%v\n", c.AppPrivateKeyPath)
+	dump += fmt.Sprintf("base-url=%v\n", c.BaseURL)
+	dump += fmt.Sprintf("upload-url=%v\n", c.UploadURL)
+	dump += fmt.Sprintf("enterprise-hosts=%v\n", c.EnterpriseHosts)
 	dump += fmt.Sprintf("workflow-file=%v\n", c.WorkflowFileName)
+	dump += fmt.Sprintf("workflow-files=%v\n", c.WorkflowFiles)
+	dump += fmt.Sprintf("all-workflows=%v\n", c.AllWorkflows)
+	dump += fmt.Sprintf("all-attempts=%v\n", c.AllAttempts)
+	dump += fmt.Sprintf("branch=%v\n", c.Branch)
+	dump += fmt.Sprintf("event=%v\n", c.Event)
+	dump += fmt.Sprintf("status=%v\n", c.Status)
+	dump += fmt.Sprintf("conclusion=%v\n", c.Conclusion)
+	dump += fmt.Sprintf("actor=%v\n", c.Actor)
+	dump += fmt.Sprintf("since=%v\n", c.Since)
+	dump += fmt.Sprintf("until=%v\n", c.Until)
 	dump += fmt.Sprintf("replace=%#v\n", c.Replace)
+	dump += fmt.Sprintf("include-skipped-steps=%v\n", c.IncludeSkippedSteps)
+	dump += fmt.Sprintf("step-key=%v\n", c.StepKey)
+	dump += fmt.Sprintf("group-by-revision=%v\n", c.GroupByRevision)
+	dump += fmt.Sprintf("revision=%v\n", c.Revisions)
+	dump += fmt.Sprintf("level=%v\n", c.Levels)
 	dump += fmt.Sprintf("cache=%v\n", c.Cache)
 	dump += fmt.Sprintf("cache-directory=%v\n", c.CacheDirectory)
+	dump += fmt.Sprintf("cache-max-size=%v\n", c.CacheMaxSize)
+	dump += fmt.Sprintf("record=%v\n", c.Record)
+	dump += fmt.Sprintf("input=%v\n", c.Inputs)
+	dump += fmt.Sprintf("database=%v\n", c.Database)
 	return dump
 }
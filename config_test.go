@@ -21,6 +21,10 @@ func Test_LoadFromTOML(t *testing.T) {
 	expectedConfig := &ProfileConfig{
 		AccessToken:      "YOUR_ACCESS_TOKEN",
 		Concurrency:      2,
+		MaxConcurrency:   10,
+		MaxRetries:       5,
+		Remote:           "origin",
+		Database:         defaultDatabasePath(),
 		Cache:            true,
 		CacheDirectory:   "/tmp/cache",
 		NumberOfJob:      100,
@@ -28,6 +32,7 @@ func Test_LoadFromTOML(t *testing.T) {
 		Owner:            "utgwkk",
 		Repository:       "Twitter-Text",
 		SortBy:           "number",
+		StepKey:          "number",
 		WorkflowFileName: "ci.yml",
 	}
 
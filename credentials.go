@@ -0,0 +1,242 @@
+package ghaprofiler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// credentialSource looks up an access token for a host outside of the configuration.
+// Lookup returns an empty string if the source has no token for the host.
+type credentialSource struct {
+	Name   string
+	Lookup func(ctx context.Context, host string) (string, error)
+}
+
+// credentialSources are consulted in order by DiscoverAccessToken
+var credentialSources = []credentialSource{
+	{Name: "GH_TOKEN", Lookup: envTokenLookup("GH_TOKEN", false)},
+	{Name: "GITHUB_TOKEN", Lookup: envTokenLookup("GITHUB_TOKEN", false)},
+	{Name: "GH_ENTERPRISE_TOKEN", Lookup: envTokenLookup("GH_ENTERPRISE_TOKEN", true)},
+	{Name: "GITHUB_ENTERPRISE_TOKEN", Lookup: envTokenLookup("GITHUB_ENTERPRISE_TOKEN", true)},
+	{Name: "gh hosts.yml", Lookup: ghHostsTokenLookup},
+	{Name: "netrc", Lookup: netrcTokenLookup},
+	{Name: "git credential fill", Lookup: gitCredentialTokenLookup},
+}
+
+// DiscoverAccessToken looks up an access token for host (e.g. github.com) from environment variables,
+// the configuration of gh, netrc and git credential helpers.
+// It returns the token and the name of the source, or empty strings if no token is found.
+func DiscoverAccessToken(ctx context.Context, host string) (token string, source string) {
+	for _, s := range credentialSources {
+		token, err := s.Lookup(ctx, host)
+		if err != nil || token == "" {
+			continue
+		}
+		return token, s.Name
+	}
+	return "", ""
+}
+
+// WebHost returns the host name of the web interface which is used by gh, netrc and git
+func (config *ClientConfig) WebHost() (string, error) {
+	host, err := config.APIHost()
+	if err != nil {
+		return "", err
+	}
+	if host == defaultAPIHost {
+		return "github.com", nil
+	}
+	return host, nil
+}
+
+func isGitHubDotCom(host string) bool {
+	return host == "github.com"
+}
+
+// envTokenLookup follows gh: GH_TOKEN and GITHUB_TOKEN are for github.com,
+// and GH_ENTERPRISE_TOKEN and GITHUB_ENTERPRISE_TOKEN are for GitHub Enterprise Server
+func envTokenLookup(name string, enterprise bool) func(context.Context, string) (string, error) {
+	return func(_ context.Context, host string) (string, error) {
+		if isGitHubDotCom(host) == enterprise {
+			return "", nil
+		}
+		return os.Getenv(name), nil
+	}
+}
+
+func ghConfigDir() (string, error) {
+	if dir := os.Getenv("GH_CONFIG_DIR"); dir != "" {
+		return dir, nil
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "gh"), nil
+	}
+	if runtime.GOOS == "windows" {
+		if dir := os.Getenv("AppData"); dir != "" {
+			return filepath.Join(dir, "GitHub CLI"), nil
+		}
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "gh"), nil
+}
+
+func ghHostsTokenLookup(_ context.Context, host string) (string, error) {
+	dir, err := ghConfigDir()
+	if err != nil {
+		return "", err
+	}
+	p, err := ioutil.ReadFile(filepath.Join(dir, "hosts.yml"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return parseGhHostsToken(p, host), nil
+}
+
+// parseGhHostsToken reads oauth_token of host from hosts.yml of gh.
+// It understands only the subset of YAML which gh writes:
+//
+//	github.com:
+//	    user: octocat
+//	    oauth_token: gho_xxxx
+func parseGhHostsToken(p []byte, host string) string {
+	inHost := false
+	hostIndent := -1
+	scanner := bufio.NewScanner(bytes.NewReader(p))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent == 0 {
+			key := strings.TrimSuffix(trimmed, ":")
+			inHost = unquoteYAMLScalar(key) == host
+			hostIndent = -1
+			continue
+		}
+		if !inHost {
+			continue
+		}
+		// ignore nested mappings such as users:
+		if hostIndent == -1 {
+			hostIndent = indent
+		}
+		if indent != hostIndent {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "oauth_token:") {
+			return unquoteYAMLScalar(strings.TrimSpace(strings.TrimPrefix(trimmed, "oauth_token:")))
+		}
+	}
+	return ""
+}
+
+func unquoteYAMLScalar(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func netrcPath() (string, error) {
+	if p := os.Getenv("NETRC"); p != "" {
+		return p, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(home, "_netrc"), nil
+	}
+	return filepath.Join(home, ".netrc"), nil
+}
+
+func netrcTokenLookup(_ context.Context, host string) (string, error) {
+	path, err := netrcPath()
+	if err != nil {
+		return "", err
+	}
+	p, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	if token := parseNetrcPassword(p, host); token != "" {
+		return token, nil
+	}
+	if isGitHubDotCom(host) {
+		return parseNetrcPassword(p, defaultAPIHost), nil
+	}
+	return "", nil
+}
+
+// parseNetrcPassword returns the password of the machine entry for host.
+// The default entry is not used so that a token is never sent to an unrelated host.
+func parseNetrcPassword(p []byte, host string) string {
+	fields := strings.Fields(string(p))
+	inMachine := false
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			if i+1 < len(fields) {
+				i++
+				inMachine = fields[i] == host
+			}
+		case "default":
+			inMachine = false
+		case "macdef":
+			// macro definitions continue until an empty line, which Fields cannot tell
+			inMachine = false
+		case "login", "account":
+			i++
+		case "password":
+			if i+1 < len(fields) {
+				i++
+				if inMachine {
+					return fields[i]
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func gitCredentialTokenLookup(ctx context.Context, host string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "credential", "fill")
+	cmd.Stdin = strings.NewReader("protocol=https\nhost=" + host + "\n\n")
+	// never prompt, or the profiler would hang waiting for input
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GCM_INTERACTIVE=never")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return parseGitCredentialPassword(out), nil
+}
+
+func parseGitCredentialPassword(p []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(p))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "password=") {
+			return strings.TrimPrefix(line, "password=")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,119 @@
+package ghaprofiler
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_ParseGhHostsToken(t *testing.T) {
+	hosts := []byte(`github.com:
+    users:
+        octocat:
+            oauth_token: nested_token
+    user: octocat
+    oauth_token: gho_dotcom
+    git_protocol: https
+"github.example.com":
+    oauth_token: "gho_enterprise"
+`)
+	testCases := []struct {
+		host     string
+		expected string
+	}{
+		{"github.com", "gho_dotcom"},
+		{"github.example.com", "gho_enterprise"},
+		{"github.invalid", ""},
+	}
+	for _, tc := range testCases {
+		if got := parseGhHostsToken(hosts, tc.host); got != tc.expected {
+			t.Errorf("host %s: expected %q, got %q", tc.host, tc.expected, got)
+		}
+	}
+}
+
+func Test_ParseNetrcPassword(t *testing.T) {
+	netrc := []byte(`machine api.github.com
+  login octocat
+  password api_token
+machine github.example.com login octocat password enterprise_token
+default login anonymous password default_token
+`)
+	testCases := []struct {
+		host     string
+		expected string
+	}{
+		{"api.github.com", "api_token"},
+		{"github.example.com", "enterprise_token"},
+		{"github.com", ""},
+	}
+	for _, tc := range testCases {
+		if got := parseNetrcPassword(netrc, tc.host); got != tc.expected {
+			t.Errorf("host %s: expected %q, got %q", tc.host, tc.expected, got)
+		}
+	}
+}
+
+func Test_ParseGitCredentialPassword(t *testing.T) {
+	out := []byte("protocol=https\nhost=github.com\nusername=octocat\npassword=credential_token\n")
+	if got := parseGitCredentialPassword(out); got != "credential_token" {
+		t.Errorf("expected credential_token, got %q", got)
+	}
+	if got := parseGitCredentialPassword([]byte("protocol=https\n")); got != "" {
+		t.Errorf("expected no password, got %q", got)
+	}
+}
+
+func Test_DiscoverAccessToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "hosts.yml"), []byte("github.example.com:\n    oauth_token: gho_enterprise\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	originalSources := credentialSources
+	defer func() { credentialSources = originalSources }()
+	// git credential helpers of the host must not be used in tests
+	credentialSources = credentialSources[:len(credentialSources)-1]
+
+	env := map[string]string{
+		"GH_TOKEN":                "",
+		"GITHUB_TOKEN":            "env_token",
+		"GH_ENTERPRISE_TOKEN":     "",
+		"GITHUB_ENTERPRISE_TOKEN": "",
+		"GH_CONFIG_DIR":           dir,
+		"NETRC":                   filepath.Join(dir, "netrc"),
+	}
+	for name, value := range env {
+		original, ok := os.LookupEnv(name)
+		os.Setenv(name, value)
+		if ok {
+			defer os.Setenv(name, original)
+		} else {
+			defer os.Unsetenv(name)
+		}
+	}
+
+	testCases := []struct {
+		host           string
+		expectedToken  string
+		expectedSource string
+	}{
+		{"github.com", "env_token", "GITHUB_TOKEN"},
+		// GITHUB_TOKEN must not be sent to GitHub Enterprise Server
+		{"github.example.com", "gho_enterprise", "gh hosts.yml"},
+		{"github.invalid", "", ""},
+	}
+	for _, tc := range testCases {
+		token, source := DiscoverAccessToken(context.Background(), tc.host)
+		if token != tc.expectedToken || source != tc.expectedSource {
+			t.Errorf("host %s: expected %q from %q, got %q from %q", tc.host, tc.expectedToken, tc.expectedSource, token, source)
+		}
+	}
+}
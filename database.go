@@ -0,0 +1,239 @@
+package ghaprofiler
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+const databaseVersion = 1
+
+var (
+	// metaBucket has the version of the database
+	metaBucket = []byte("meta")
+	// workflowRunsBucket has a bucket for each workflow, which maps run IDs to WorkflowRunWithJobs
+	workflowRunsBucket = []byte("workflow_runs")
+	// pendingWorkflowRunsBucket has a bucket for each workflow, which has IDs of workflow runs
+	// stored while in progress, to be fetched again on the next sync
+	pendingWorkflowRunsBucket = []byte("pending_workflow_runs")
+	// syncCursorsBucket maps each workflow to the SyncCursor of its last complete sync
+	syncCursorsBucket = []byte("sync_cursors")
+
+	databaseVersionKey = []byte("version")
+)
+
+// Database stores workflow runs with their jobs and steps to profile them without fetching again
+type Database struct {
+	db *bolt.DB
+}
+
+var defaultDatabaseFileName = "github-actions-profiler.db"
+
+func defaultDatabasePath() string {
+	userConfigDir, err := os.UserConfigDir()
+	if err == nil {
+		return filepath.Join(userConfigDir, "github-actions-profiler", defaultDatabaseFileName)
+	}
+	return defaultDatabaseFileName
+}
+
+// OpenDatabase opens the database file, creating it if it does not exist
+func OpenDatabase(path string) (*Database, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		if err == bolt.ErrTimeout {
+			return nil, fmt.Errorf("Database %s is used by another process", path)
+		}
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		if version := meta.Get(databaseVersionKey); version != nil {
+			if v := binary.BigEndian.Uint64(version); v != databaseVersion {
+				return fmt.Errorf("Unsupported database version: %d", v)
+			}
+		} else if err := meta.Put(databaseVersionKey, encodeDatabaseID(databaseVersion)); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(workflowRunsBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(pendingWorkflowRunsBucket); err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(syncCursorsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Database{db: db}, nil
+}
+
+func (d *Database) Close() error {
+	return d.db.Close()
+}
+
+// workflowBucketKey identifies a workflow of a repository.
+// NUL never appears in repository names and workflow file names.
+func workflowBucketKey(repository, workflowFileName string) []byte {
+	return []byte(repository + "\x00" + workflowFileName)
+}
+
+func parseWorkflowBucketKey(key []byte) (repository, workflowFileName string) {
+	splitted := strings.SplitN(string(key), "\x00", 2)
+	if len(splitted) != 2 {
+		return string(key), ""
+	}
+	return splitted[0], splitted[1]
+}
+
+// encodeDatabaseID encodes an ID in big endian so that keys are sorted by ID
+func encodeDatabaseID(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+// PutWorkflowRuns stores workflow runs, and marks ones in progress as pending
+func (d *Database) PutWorkflowRuns(runs []*WorkflowRunWithJobs) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		for _, run := range runs {
+			workflowKey := workflowBucketKey(run.Repository, run.WorkflowFileName)
+			runsBucket, err := tx.Bucket(workflowRunsBucket).CreateBucketIfNotExists(workflowKey)
+			if err != nil {
+				return err
+			}
+			pendingBucket, err := tx.Bucket(pendingWorkflowRunsBucket).CreateBucketIfNotExists(workflowKey)
+			if err != nil {
+				return err
+			}
+
+			p, err := json.Marshal(run)
+			if err != nil {
+				return err
+			}
+			key := encodeDatabaseID(uint64(run.Run.GetID()))
+			if err := runsBucket.Put(key, p); err != nil {
+				return err
+			}
+			if isImmutableWorkflowRun(run.Run, run.Jobs) {
+				err = pendingBucket.Delete(key)
+			} else {
+				err = pendingBucket.Put(key, []byte{})
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// HasWorkflowRun reports whether the workflow run is stored
+func (d *Database) HasWorkflowRun(repository, workflowFileName string, runID int64) (bool, error) {
+	found := false
+	err := d.db.View(func(tx *bolt.Tx) error {
+		runs := tx.Bucket(workflowRunsBucket).Bucket(workflowBucketKey(repository, workflowFileName))
+		found = runs != nil && runs.Get(encodeDatabaseID(uint64(runID))) != nil
+		return nil
+	})
+	return found, err
+}
+
+// SyncCursor is how the workflow runs of a workflow were listed by the last complete sync.
+// Later syncs list only workflow runs newer than the stored ones while the cursor covers what they select.
+type SyncCursor struct {
+	// Filter identifies the filters of workflow runs which the sync listed
+	Filter string `json:"filter"`
+	// Since is the creation time of the oldest workflow run which the sync covered, or zero for the whole history
+	Since time.Time `json:"since"`
+}
+
+// covers reports whether the sync listed the workflow runs which filter and since select, except newer ones
+func (c *SyncCursor) covers(filter string, since time.Time) bool {
+	if c == nil || c.Filter != filter {
+		return false
+	}
+	// workflow runs older than the cursor are listed only if since asks for them
+	return since.IsZero() || !since.Before(c.Since)
+}
+
+// SyncCursor returns the cursor of the last complete sync of the workflow, or nil if it has not been synced
+func (d *Database) SyncCursor(repository, workflowFileName string) (*SyncCursor, error) {
+	var cursor *SyncCursor
+	err := d.db.View(func(tx *bolt.Tx) error {
+		p := tx.Bucket(syncCursorsBucket).Get(workflowBucketKey(repository, workflowFileName))
+		if p == nil {
+			return nil
+		}
+		cursor = &SyncCursor{}
+		return json.Unmarshal(p, cursor)
+	})
+	return cursor, err
+}
+
+// PutSyncCursor stores the cursor of a complete sync of the workflow
+func (d *Database) PutSyncCursor(repository, workflowFileName string, cursor *SyncCursor) error {
+	p, err := json.Marshal(cursor)
+	if err != nil {
+		return err
+	}
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(syncCursorsBucket).Put(workflowBucketKey(repository, workflowFileName), p)
+	})
+}
+
+// PendingWorkflowRunIDs returns IDs of workflow runs which were stored while in progress
+func (d *Database) PendingWorkflowRunIDs(repository, workflowFileName string) ([]int64, error) {
+	var ids []int64
+	err := d.db.View(func(tx *bolt.Tx) error {
+		pending := tx.Bucket(pendingWorkflowRunsBucket).Bucket(workflowBucketKey(repository, workflowFileName))
+		if pending == nil {
+			return nil
+		}
+		return pending.ForEach(func(k, _ []byte) error {
+			ids = append(ids, int64(binary.BigEndian.Uint64(k)))
+			return nil
+		})
+	})
+	return ids, err
+}
+
+// LoadWorkflowRuns returns stored workflow runs of the workflows which match.
+// Workflow runs of each workflow are sorted from newest to oldest.
+func (d *Database) LoadWorkflowRuns(match func(repository, workflowFileName string) bool) ([]*WorkflowRunWithJobs, error) {
+	var workflowRuns []*WorkflowRunWithJobs
+	err := d.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(workflowRunsBucket).ForEach(func(workflowKey, _ []byte) error {
+			repository, workflowFileName := parseWorkflowBucketKey(workflowKey)
+			if !match(repository, workflowFileName) {
+				return nil
+			}
+			c := tx.Bucket(workflowRunsBucket).Bucket(workflowKey).Cursor()
+			for k, v := c.Last(); k != nil; k, v = c.Prev() {
+				var run WorkflowRunWithJobs
+				if err := json.Unmarshal(v, &run); err != nil {
+					return errors.Wrapf(err, "failed to decode workflow run %d of %s of %s", binary.BigEndian.Uint64(k), workflowFileName, repository)
+				}
+				workflowRuns = append(workflowRuns, &run)
+			}
+			return nil
+		})
+	})
+	return workflowRuns, err
+}
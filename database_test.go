@@ -0,0 +1,371 @@
+package ghaprofiler
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+func newTestDatabase(t *testing.T) (*Database, func()) {
+	dir, err := ioutil.TempDir("", "database")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := OpenDatabase(filepath.Join(dir, "test.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func newTestStoredRun(repository, workflowFileName string, id int64, status string) *WorkflowRunWithJobs {
+	return &WorkflowRunWithJobs{
+		Repository:       repository,
+		WorkflowFileName: workflowFileName,
+		Run: &github.WorkflowRun{
+			ID:        github.Int64(id),
+			Status:    github.String(status),
+			CreatedAt: &github.Timestamp{Time: testBaseTime.Add(time.Duration(id) * time.Hour)},
+			UpdatedAt: &github.Timestamp{Time: testBaseTime.Add(time.Duration(id) * time.Hour)},
+		},
+		Jobs: []*github.WorkflowJob{{ID: github.Int64(id * 10), Status: github.String(status)}},
+	}
+}
+
+func Test_Database(t *testing.T) {
+	db, teardown := newTestDatabase(t)
+	defer teardown()
+
+	err := db.PutWorkflowRuns([]*WorkflowRunWithJobs{
+		newTestStoredRun("owner/repo", "ci.yml", 1, "completed"),
+		newTestStoredRun("owner/repo", "ci.yml", 300, "in_progress"),
+		newTestStoredRun("owner/repo", "ci.yml", 2, "completed"),
+		newTestStoredRun("owner/other", "ci.yml", 3, "completed"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found, err := db.HasWorkflowRun("owner/repo", "ci.yml", 2); err != nil || !found {
+		t.Fatalf("expected run 2 stored, got %v, %v", found, err)
+	}
+	if found, err := db.HasWorkflowRun("owner/repo", "release.yml", 2); err != nil || found {
+		t.Fatalf("expected run 2 of release.yml not stored, got %v, %v", found, err)
+	}
+
+	pending, err := db.PendingWorkflowRunIDs("owner/repo", "ci.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0] != 300 {
+		t.Fatalf("expected run 300 pending, got %v", pending)
+	}
+	// a completed run is no longer pending
+	if err := db.PutWorkflowRuns([]*WorkflowRunWithJobs{newTestStoredRun("owner/repo", "ci.yml", 300, "completed")}); err != nil {
+		t.Fatal(err)
+	}
+	pending, err = db.PendingWorkflowRunIDs("owner/repo", "ci.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("expected no runs pending, got %v", pending)
+	}
+
+	runs, err := db.LoadWorkflowRuns(func(repository, workflowFileName string) bool {
+		return repository == "owner/repo"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, run := range runs {
+		ids = append(ids, run.Run.GetID())
+	}
+	// newest first, even if IDs have different number of digits
+	if len(ids) != 3 || ids[0] != 300 || ids[1] != 2 || ids[2] != 1 {
+		t.Fatalf("unexpected runs: %v", ids)
+	}
+	if runs[0].Run.GetStatus() != "completed" || len(runs[0].Jobs) != 1 {
+		t.Fatalf("unexpected run: %+v", runs[0])
+	}
+}
+
+var testRunPathPattern = regexp.MustCompile(`/actions/runs/(\d+)(/jobs)?$`)
+
+func Test_SyncWorkflow(t *testing.T) {
+	db, teardown := newTestDatabase(t)
+	defer teardown()
+
+	var mu sync.Mutex
+	runs := map[int64]string{1: "completed", 2: "in_progress", 3: "completed"}
+	var listedRuns []int64
+	var fetchedRuns []int64
+	client, teardownClient := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		newRun := func(id int64) *github.WorkflowRun {
+			return newTestStoredRun("owner/repo", "ci.yml", id, runs[id]).Run
+		}
+		if m := testRunPathPattern.FindStringSubmatch(r.URL.Path); m != nil {
+			id, _ := strconv.ParseInt(m[1], 10, 64)
+			if m[2] == "" {
+				fetchedRuns = append(fetchedRuns, id)
+				json.NewEncoder(w).Encode(newRun(id))
+				return
+			}
+			json.NewEncoder(w).Encode(&github.Jobs{Jobs: []*github.WorkflowJob{{ID: github.Int64(id * 10), Status: github.String(runs[id])}}})
+			return
+		}
+		// newest first
+		var list []*github.WorkflowRun
+		for id := int64(len(runs)); id > 0; id-- {
+			listedRuns = append(listedRuns, id)
+			list = append(list, newRun(id))
+		}
+		json.NewEncoder(w).Encode(&github.WorkflowRuns{WorkflowRuns: list})
+	}))
+	defer teardownClient()
+
+	// number-of-job limits only the first sync
+	p := newTestProfiler(t, WithClient(client), WithConcurrencyLimiter(NewFixedConcurrencyLimiter(2)), WithDatabase(db), WithNumberOfRuns(2))
+	runSync := func() {
+		if err := p.syncWorkflow(context.Background(), testRepository, "ci.yml"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runSync()
+	if found, err := db.HasWorkflowRun("owner/repo", "ci.yml", 1); err != nil || found {
+		t.Fatalf("expected run 1 not stored, got %v, %v", found, err)
+	}
+	pending, err := db.PendingWorkflowRunIDs("owner/repo", "ci.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0] != 2 {
+		t.Fatalf("expected run 2 pending, got %v", pending)
+	}
+
+	// run 2 completes and more runs than number-of-job are created
+	runs[2] = "completed"
+	runs[4] = "completed"
+	runs[5] = "completed"
+	runs[6] = "completed"
+	listedRuns, fetchedRuns = nil, nil
+	runSync()
+
+	// listing stops at run 3, which is stored by the last sync
+	if len(listedRuns) != 6 || len(fetchedRuns) != 1 || fetchedRuns[0] != 2 {
+		t.Fatalf("unexpected requests: listed %v, fetched %v", listedRuns, fetchedRuns)
+	}
+	stored, err := db.LoadWorkflowRuns(func(string, string) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 5 {
+		t.Fatalf("expected 5 runs stored, got %d", len(stored))
+	}
+	for _, run := range stored {
+		if run.Run.GetStatus() != "completed" || run.Jobs[0].GetStatus() != "completed" {
+			t.Errorf("run %d is not updated: %s", run.Run.GetID(), run.Run.GetStatus())
+		}
+	}
+	pending, err = db.PendingWorkflowRunIDs("owner/repo", "ci.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("expected no runs pending, got %v", pending)
+	}
+}
+
+func Test_SyncWorkflowFilterChanged(t *testing.T) {
+	db, teardown := newTestDatabase(t)
+	defer teardown()
+
+	var mu sync.Mutex
+	var fetchedRuns []int64
+	client, teardownClient := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if m := testRunPathPattern.FindStringSubmatch(r.URL.Path); m != nil {
+			id, _ := strconv.ParseInt(m[1], 10, 64)
+			fetchedRuns = append(fetchedRuns, id)
+			json.NewEncoder(w).Encode(&github.Jobs{})
+			return
+		}
+		// runs of even IDs are on main, and newest first
+		branch := r.URL.Query().Get("branch")
+		var list []*github.WorkflowRun
+		for id := int64(4); id > 0; id-- {
+			run := newTestStoredRun("owner/repo", "ci.yml", id, "completed").Run
+			run.HeadBranch = github.String("topic")
+			if id%2 == 0 {
+				run.HeadBranch = github.String("main")
+			}
+			if branch == "" || run.GetHeadBranch() == branch {
+				list = append(list, run)
+			}
+		}
+		json.NewEncoder(w).Encode(&github.WorkflowRuns{WorkflowRuns: list})
+	}))
+	defer teardownClient()
+
+	runSync := func(opts ...ProfilerOption) {
+		t.Helper()
+		fetchedRuns = nil
+		p := newTestProfiler(t, append([]ProfilerOption{WithClient(client), WithConcurrencyLimiter(NewFixedConcurrencyLimiter(1)), WithDatabase(db)}, opts...)...)
+		if err := p.syncWorkflow(context.Background(), testRepository, "ci.yml"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runSync(WithBranch("main"))
+	if len(fetchedRuns) != 2 || fetchedRuns[0] != 2 || fetchedRuns[1] != 4 {
+		t.Fatalf("unexpected runs fetched on main: %v", fetchedRuns)
+	}
+	// runs skipped by the sync on main are fetched although run 4 is stored
+	runSync()
+	if len(fetchedRuns) != 2 || fetchedRuns[0] != 1 || fetchedRuns[1] != 3 {
+		t.Fatalf("unexpected runs fetched after the filter changed: %v", fetchedRuns)
+	}
+	// nothing is new for the same filter
+	runSync()
+	if len(fetchedRuns) != 0 {
+		t.Fatalf("unexpected runs fetched: %v", fetchedRuns)
+	}
+
+	cursor, err := db.SyncCursor("owner/repo", "ci.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor == nil || cursor.Filter != "" || !cursor.Since.IsZero() {
+		t.Fatalf("unexpected cursor: %+v", cursor)
+	}
+	// an earlier since than the cursor lists older runs again
+	if !cursor.covers("", testBaseTime) {
+		t.Fatal("the whole history must cover any since")
+	}
+	cursor.Since = testBaseTime.Add(2 * time.Hour)
+	if cursor.covers("", testBaseTime) || !cursor.covers("", time.Time{}) || cursor.covers("branch=main", time.Time{}) {
+		t.Fatalf("unexpected coverage of %+v", cursor)
+	}
+}
+
+func Test_LoadWorkflowRunsFromDatabase(t *testing.T) {
+	db, teardown := newTestDatabase(t)
+	defer teardown()
+
+	var stored []*WorkflowRunWithJobs
+	for id := int64(1); id <= 5; id++ {
+		stored = append(stored, newTestStoredRun("owner/repo", "ci.yml", id, "completed"))
+	}
+	stored = append(stored,
+		newTestStoredRun("owner/repo", "release.yml", 6, "completed"),
+		newTestStoredRun("owner/other", "ci.yml", 7, "completed"),
+	)
+	if err := db.PutWorkflowRuns(stored); err != nil {
+		t.Fatal(err)
+	}
+
+	p := newTestProfiler(t,
+		WithDatabase(db),
+		WithRepository("owner", "repo"),
+		WithWorkflowFiles("ci.yml"),
+		WithNumberOfRuns(2),
+	)
+	runs, err := p.loadWorkflowRunsFromDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the newest 2 runs
+	if len(runs) != 2 || runs[0].Run.GetID() != 5 || runs[1].Run.GetID() != 4 {
+		t.Fatalf("unexpected runs: %+v", runs)
+	}
+
+	p = newTestProfiler(t,
+		WithDatabase(db),
+		WithRepository("owner", "repo"),
+		WithWorkflowFiles("ci.yml"),
+		WithNumberOfRuns(2),
+		WithTimeRange(time.Time{}, testBaseTime.Add(4*time.Hour)),
+	)
+	runs, err = p.loadWorkflowRunsFromDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every run created until the time, as the window is not limited by number-of-job
+	if len(runs) != 4 || runs[0].Run.GetID() != 4 || runs[3].Run.GetID() != 1 {
+		t.Fatalf("unexpected runs: %+v", runs)
+	}
+
+	// the database is profiled without a repository or a workflow
+	p = newTestProfiler(t, WithDatabase(db))
+	if err := p.validate(true); err != nil {
+		t.Fatal(err)
+	}
+	runs, err = p.loadWorkflowRunsFromDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != len(stored) {
+		t.Fatalf("expected every stored run, got %d", len(runs))
+	}
+}
+
+func Test_SyncWorkflowInterrupted(t *testing.T) {
+	db, teardown := newTestDatabase(t)
+	defer teardown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client, teardownClient := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m := testRunPathPattern.FindStringSubmatch(r.URL.Path); m != nil {
+			if m[1] == "3" {
+				// interrupted while fetching jobs of run 3
+				cancel()
+				<-r.Context().Done()
+				return
+			}
+			json.NewEncoder(w).Encode(&github.Jobs{})
+			return
+		}
+		var list []*github.WorkflowRun
+		for id := int64(4); id > 0; id-- {
+			list = append(list, newTestStoredRun("owner/repo", "ci.yml", id, "completed").Run)
+		}
+		json.NewEncoder(w).Encode(&github.WorkflowRuns{WorkflowRuns: list})
+	}))
+	defer teardownClient()
+
+	p := newTestProfiler(t, WithClient(client), WithConcurrencyLimiter(NewFixedConcurrencyLimiter(1)), WithDatabase(db))
+	err := p.syncWorkflow(ctx, testRepository, "ci.yml")
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	// runs older than the interrupted one are stored, and newer ones are fetched on the next sync
+	for id, expected := range map[int64]bool{1: true, 2: true, 3: false, 4: false} {
+		found, err := db.HasWorkflowRun("owner/repo", "ci.yml", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Errorf("run %d: expected stored=%v, got %v", id, expected, found)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -29,11 +30,48 @@ func AvailableFormatsForCLI() string {
 }
 
 type ProfileForFormatter struct {
-	Name    string             `json:"name"`
-	Profile []*TaskStepProfile `json:"profile"`
+	Name string `json:"name"`
+	// Duration is the profile of durations of the job itself, which is nil unless the job level is output
+	Duration *JobDurationProfile `json:"duration,omitempty"`
+	// Profile is nil unless the step level is output
+	Profile []*TaskStepProfile `json:"profile,omitempty"`
 }
 
-type ProfileInput []*ProfileForFormatter
+type WorkflowProfileForFormatter struct {
+	Repository string `json:"repository,omitempty"`
+	// Repositories is set instead of Repository when the profile is aggregated across repositories
+	Repositories []string `json:"repositories,omitempty"`
+	Name         string   `json:"name"`
+	// Revision is the revision of the workflow file, which is set only when grouped by revision
+	Revision string `json:"revision,omitempty"`
+	// Partial is set when fetching workflow runs was interrupted
+	Partial bool `json:"partial,omitempty"`
+	// Runs is nil unless the run level is output
+	Runs []*RunMetricProfile `json:"runs,omitempty"`
+	// JobQueues are queue times of each job after the jobs it needs completed, which are nil unless the job level is output
+	JobQueues []*TaskStepProfile `json:"job_queues,omitempty"`
+	// JobStartOffsets are times since the workflow run started of jobs whose needs are unknown
+	JobStartOffsets []*TaskStepProfile     `json:"job_start_offsets,omitempty"`
+	Jobs            []*ProfileForFormatter `json:"jobs"`
+}
+
+func (p *WorkflowProfileForFormatter) Title() string {
+	title := p.Name
+	if len(p.Repositories) > 0 {
+		title = fmt.Sprintf("%s (aggregated across %s)", p.Name, strings.Join(p.Repositories, ", "))
+	} else if p.Repository != "" {
+		title = fmt.Sprintf("%s (%s)", p.Name, p.Repository)
+	}
+	if p.Revision != "" {
+		title += fmt.Sprintf(" at revision %s", shortRevision(p.Revision))
+	}
+	if p.Partial {
+		title += " [partial]"
+	}
+	return title
+}
+
+type ProfileInput []*WorkflowProfileForFormatter
 
 func IsValidFormatName(formatName string) bool {
 	for _, available := range availableFormats {
@@ -47,57 +85,382 @@ func IsValidFormatName(formatName string) bool {
 func WriteJSON(w io.Writer, profileResult ProfileInput) (err error) {
 	encoder := json.NewEncoder(w)
 	err = encoder.Encode(struct {
-		Profiles []*ProfileForFormatter `json:"profiles"`
+		Workflows []*WorkflowProfileForFormatter `json:"workflows"`
 	}{
-		Profiles: profileResult,
+		Workflows: profileResult,
 	})
 	return
 }
 
 func WriteTable(w io.Writer, profileResult ProfileInput, markdown bool) error {
-	for _, p := range profileResult {
-		table := tablewriter.NewWriter(w)
-		table.SetAutoFormatHeaders(false)
+	for i, workflow := range profileResult {
 		if markdown {
-			table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
-			table.SetCenterSeparator("|")
-			table.SetAutoWrapText(false)
+			fmt.Fprintf(w, "# Workflow: %s\n", workflow.Title())
+		} else {
+			fmt.Fprintf(w, "Workflow: %s\n", workflow.Title())
+		}
+		fmt.Fprintln(w)
+		writeRunTable(w, workflow, markdown)
+		writeJobDurationTable(w, workflow, markdown)
+		writeJobTimingTable(w, "Job queue times", workflow.JobQueues, markdown)
+		writeJobTimingTable(w, jobStartOffsetsTitle, workflow.JobStartOffsets, markdown)
+		for _, p := range workflow.Jobs {
+			if p.Profile == nil {
+				continue
+			}
+			table := tablewriter.NewWriter(w)
+			table.SetAutoFormatHeaders(false)
+			if markdown {
+				table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
+				table.SetCenterSeparator("|")
+				table.SetAutoWrapText(false)
+			}
+			table.SetHeader(taskStepProfileHeader)
+			for _, p := range p.Profile {
+				table.Append(taskStepProfileRow(p))
+			}
+			if markdown {
+				fmt.Fprintf(w, "## Job: %s\n", p.Name)
+				fmt.Fprintln(w)
+			} else {
+				fmt.Fprintf(w, "Job: %s\n", p.Name)
+			}
+			table.Render()
+			fmt.Fprintln(w)
+		}
+		if revisions := revisionsEndingAt(profileResult, i); len(revisions) > 1 {
+			writeRevisionComparisonTable(w, revisions, markdown)
 		}
-		table.SetHeader([]string{"Number", "Min", "Median", "Mean", "P50", "P90", "P95", "P99", "Max", "Name"})
-		for _, p := range p.Profile {
-			table.Append([]string{
-				strconv.FormatInt(p.Number, 10),
-				strconv.FormatFloat(p.Min, 'f', 6, 64),
-				strconv.FormatFloat(p.Median, 'f', 6, 64),
-				strconv.FormatFloat(p.Mean, 'f', 6, 64),
-				strconv.FormatFloat(p.Percentiles[50].Value, 'f', 6, 64),
-				strconv.FormatFloat(p.Percentiles[90].Value, 'f', 6, 64),
-				strconv.FormatFloat(p.Percentiles[95].Value, 'f', 6, 64),
-				strconv.FormatFloat(p.Percentiles[99].Value, 'f', 6, 64),
-				strconv.FormatFloat(p.Max, 'f', 6, 64),
-				p.Name,
+	}
+	return nil
+}
+
+// revisionsEndingAt returns profiles of revisions of the same workflow next to each other, which end at profileResult[i],
+// or nil unless profileResult[i] is the last revision of the workflow
+func revisionsEndingAt(profileResult ProfileInput, i int) []*WorkflowProfileForFormatter {
+	if profileResult[i].Revision == "" {
+		return nil
+	}
+	if i+1 < len(profileResult) && profileResult[i+1].Revision != "" && isSameWorkflow(profileResult[i], profileResult[i+1]) {
+		return nil
+	}
+	start := i
+	for start > 0 && profileResult[start-1].Revision != "" && isSameWorkflow(profileResult[start-1], profileResult[i]) {
+		start--
+	}
+	return profileResult[start : i+1]
+}
+
+func isSameWorkflow(a, b *WorkflowProfileForFormatter) bool {
+	return a.Name == b.Name && a.Repository == b.Repository && strings.Join(a.Repositories, ",") == strings.Join(b.Repositories, ",")
+}
+
+// revisionComparison returns a table comparing means of run metrics, job durations and steps among revisions side by side.
+// Steps are matched by name in each job, and steps with the same name are matched in order.
+func revisionComparison(revisions []*WorkflowProfileForFormatter) (header []string, rows [][]string) {
+	header = []string{"Job", "Name"}
+	for _, revision := range revisions {
+		header = append(header, shortRevision(revision.Revision))
+	}
+
+	type rowKey struct {
+		job        string
+		name       string
+		occurrence int
+	}
+	var jobNames []string
+	keysByJobName := make(map[string][]rowKey)
+	means := make(map[rowKey][]string)
+	add := func(i int, key rowKey, mean float64) {
+		if _, ok := means[key]; !ok {
+			if _, ok := keysByJobName[key.job]; !ok {
+				jobNames = append(jobNames, key.job)
+			}
+			keysByJobName[key.job] = append(keysByJobName[key.job], key)
+			means[key] = make([]string, len(revisions))
+			for j := range means[key] {
+				means[key][j] = "-"
+			}
+		}
+		means[key][i] = strconv.FormatFloat(mean, 'f', 6, 64)
+	}
+	for i, revision := range revisions {
+		for _, p := range revision.Runs {
+			add(i, rowKey{job: "(run)", name: p.Name}, p.Mean)
+		}
+		for _, job := range revision.Jobs {
+			if job.Duration != nil {
+				add(i, rowKey{job: job.Name, name: "(job)"}, job.Duration.Mean)
+			}
+			steps := make([]*TaskStepProfile, len(job.Profile))
+			copy(steps, job.Profile)
+			sort.SliceStable(steps, func(i, j int) bool {
+				return steps[i].Number < steps[j].Number
 			})
+			occurrences := make(map[string]int)
+			for _, step := range steps {
+				name := taskStepDisplayName(step)
+				add(i, rowKey{job: job.Name, name: name, occurrence: occurrences[name]}, step.Mean)
+				occurrences[name]++
+			}
 		}
-		if markdown {
-			fmt.Fprintf(w, "# Job: %s\n", p.Name)
-			fmt.Fprintln(w)
-		} else {
-			fmt.Fprintf(w, "Job: %s\n", p.Name)
+	}
+
+	for _, jobName := range jobNames {
+		for _, key := range keysByJobName[jobName] {
+			rows = append(rows, append([]string{key.job, key.name}, means[key]...))
+		}
+	}
+	return header, rows
+}
+
+// revisionComparisonTitle returns the title of the workflow without a revision
+func revisionComparisonTitle(revisions []*WorkflowProfileForFormatter) string {
+	workflow := *revisions[0]
+	workflow.Revision = ""
+	workflow.Partial = false
+	return workflow.Title()
+}
+
+// writeRevisionComparisonTable writes a table comparing means among revisions of the workflow side by side
+func writeRevisionComparisonTable(w io.Writer, revisions []*WorkflowProfileForFormatter, markdown bool) {
+	header, rows := revisionComparison(revisions)
+	table := tablewriter.NewWriter(w)
+	table.SetAutoFormatHeaders(false)
+	if markdown {
+		table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
+		table.SetCenterSeparator("|")
+		table.SetAutoWrapText(false)
+	}
+	table.SetHeader(header)
+	table.AppendBulk(rows)
+	if markdown {
+		fmt.Fprintf(w, "# Revisions: %s\n", revisionComparisonTitle(revisions))
+	} else {
+		fmt.Fprintf(w, "Revisions: %s\n", revisionComparisonTitle(revisions))
+	}
+	fmt.Fprintln(w)
+	table.Render()
+	fmt.Fprintln(w)
+}
+
+var taskStepProfileHeader = []string{"Number", "Executed", "Skipped", "Incomplete", "Min", "Median", "Mean", "P50", "P90", "P95", "P99", "Max", "Name"}
+
+func taskStepProfileRow(p *TaskStepProfile) []string {
+	return []string{
+		strconv.FormatInt(p.Number, 10),
+		strconv.Itoa(p.Executed),
+		strconv.Itoa(p.Skipped),
+		strconv.Itoa(p.Incomplete),
+		strconv.FormatFloat(p.Min, 'f', 6, 64),
+		strconv.FormatFloat(p.Median, 'f', 6, 64),
+		strconv.FormatFloat(p.Mean, 'f', 6, 64),
+		strconv.FormatFloat(p.Percentiles[50].Value, 'f', 6, 64),
+		strconv.FormatFloat(p.Percentiles[90].Value, 'f', 6, 64),
+		strconv.FormatFloat(p.Percentiles[95].Value, 'f', 6, 64),
+		strconv.FormatFloat(p.Percentiles[99].Value, 'f', 6, 64),
+		strconv.FormatFloat(p.Max, 'f', 6, 64),
+		taskStepDisplayName(p),
+	}
+}
+
+// taskStepDisplayName returns every name of the steps if the steps have several names
+func taskStepDisplayName(p *TaskStepProfile) string {
+	if len(p.Names) > 1 {
+		return strings.Join(p.Names, " / ")
+	}
+	return p.Name
+}
+
+const jobStartOffsetsTitle = "Job start times since run start (needs unknown)"
+
+// writeJobTimingTable writes a table of queue times or start times of each job of the workflow
+func writeJobTimingTable(w io.Writer, title string, profiles []*TaskStepProfile, markdown bool) {
+	if len(profiles) == 0 {
+		return
+	}
+	table := tablewriter.NewWriter(w)
+	table.SetAutoFormatHeaders(false)
+	if markdown {
+		table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
+		table.SetCenterSeparator("|")
+		table.SetAutoWrapText(false)
+	}
+	table.SetHeader(taskStepProfileHeader)
+	for _, p := range profiles {
+		table.Append(taskStepProfileRow(p))
+	}
+	if markdown {
+		fmt.Fprintf(w, "## %s\n", title)
+		fmt.Fprintln(w)
+	} else {
+		fmt.Fprintln(w, title)
+	}
+	table.Render()
+	fmt.Fprintln(w)
+}
+
+// writeRunTable writes a table of metrics of workflow runs
+func writeRunTable(w io.Writer, workflow *WorkflowProfileForFormatter, markdown bool) {
+	if len(workflow.Runs) == 0 {
+		return
+	}
+	table := tablewriter.NewWriter(w)
+	table.SetAutoFormatHeaders(false)
+	if markdown {
+		table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
+		table.SetCenterSeparator("|")
+		table.SetAutoWrapText(false)
+	}
+	table.SetHeader(runHeader)
+	for _, p := range workflow.Runs {
+		table.Append(runRow(p))
+	}
+	if markdown {
+		fmt.Fprintln(w, "## Workflow runs")
+		fmt.Fprintln(w)
+	} else {
+		fmt.Fprintln(w, "Workflow runs")
+	}
+	table.Render()
+	fmt.Fprintln(w)
+}
+
+var runHeader = []string{"Runs", "Min", "Median", "Mean", "P50", "P90", "P95", "P99", "Max", "Name"}
+
+func runRow(p *RunMetricProfile) []string {
+	return []string{
+		strconv.Itoa(p.Runs),
+		strconv.FormatFloat(p.Min, 'f', 6, 64),
+		strconv.FormatFloat(p.Median, 'f', 6, 64),
+		strconv.FormatFloat(p.Mean, 'f', 6, 64),
+		strconv.FormatFloat(p.Percentiles[50].Value, 'f', 6, 64),
+		strconv.FormatFloat(p.Percentiles[90].Value, 'f', 6, 64),
+		strconv.FormatFloat(p.Percentiles[95].Value, 'f', 6, 64),
+		strconv.FormatFloat(p.Percentiles[99].Value, 'f', 6, 64),
+		strconv.FormatFloat(p.Max, 'f', 6, 64),
+		p.Name,
+	}
+}
+
+// hasJobDurations reports whether durations of jobs are profiled
+func hasJobDurations(workflow *WorkflowProfileForFormatter) bool {
+	for _, p := range workflow.Jobs {
+		if p.Duration != nil {
+			return true
 		}
-		table.Render()
+	}
+	return false
+}
+
+// writeJobDurationTable writes a table of durations of each job of the workflow
+func writeJobDurationTable(w io.Writer, workflow *WorkflowProfileForFormatter, markdown bool) {
+	if !hasJobDurations(workflow) {
+		return
+	}
+	table := tablewriter.NewWriter(w)
+	table.SetAutoFormatHeaders(false)
+	if markdown {
+		table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
+		table.SetCenterSeparator("|")
+		table.SetAutoWrapText(false)
+	}
+	table.SetHeader(jobDurationHeader)
+	for _, p := range workflow.Jobs {
+		if p.Duration != nil {
+			table.Append(jobDurationRow(p))
+		}
+	}
+	if markdown {
+		fmt.Fprintln(w, "## Job durations")
 		fmt.Fprintln(w)
+	} else {
+		fmt.Fprintln(w, "Job durations")
+	}
+	table.Render()
+	fmt.Fprintln(w)
+}
+
+var jobDurationHeader = []string{"Executed", "Skipped", "Min", "Median", "Mean", "P50", "P90", "P95", "P99", "Max", "Overhead", "Name"}
+
+func jobDurationRow(p *ProfileForFormatter) []string {
+	d := p.Duration
+	return []string{
+		strconv.Itoa(d.Executed),
+		strconv.Itoa(d.Skipped),
+		strconv.FormatFloat(d.Min, 'f', 6, 64),
+		strconv.FormatFloat(d.Median, 'f', 6, 64),
+		strconv.FormatFloat(d.Mean, 'f', 6, 64),
+		strconv.FormatFloat(d.Percentiles[50].Value, 'f', 6, 64),
+		strconv.FormatFloat(d.Percentiles[90].Value, 'f', 6, 64),
+		strconv.FormatFloat(d.Percentiles[95].Value, 'f', 6, 64),
+		strconv.FormatFloat(d.Percentiles[99].Value, 'f', 6, 64),
+		strconv.FormatFloat(d.Max, 'f', 6, 64),
+		strconv.FormatFloat(d.Overhead, 'f', 6, 64),
+		p.Name,
 	}
-	return nil
 }
 
 func WriteTSV(w io.Writer, profileResult ProfileInput) error {
-	for _, p := range profileResult {
-		fmt.Fprintf(w, "Job: %s\n", p.Name)
-		fmt.Fprintln(w, "Number\tMin\tMedian\tMean\tP50\tP90\tP95\tP99\tMax\tName")
-		for _, p := range p.Profile {
-			fmt.Fprintf(w, "%d\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%s\n", p.Number, p.Min, p.Median, p.Mean, p.Percentiles[50].Value, p.Percentiles[90].Value, p.Percentiles[95].Value, p.Percentiles[99].Value, p.Max, p.Name)
-		}
+	for i, workflow := range profileResult {
+		fmt.Fprintf(w, "Workflow: %s\n", workflow.Title())
 		fmt.Fprintln(w)
+		if len(workflow.Runs) > 0 {
+			fmt.Fprintln(w, "Workflow runs")
+			fmt.Fprintln(w, strings.Join(runHeader, "\t"))
+			for _, p := range workflow.Runs {
+				fmt.Fprintln(w, strings.Join(runRow(p), "\t"))
+			}
+			fmt.Fprintln(w)
+		}
+		if hasJobDurations(workflow) {
+			fmt.Fprintln(w, "Job durations")
+			fmt.Fprintln(w, strings.Join(jobDurationHeader, "\t"))
+			for _, p := range workflow.Jobs {
+				if p.Duration != nil {
+					fmt.Fprintln(w, strings.Join(jobDurationRow(p), "\t"))
+				}
+			}
+			fmt.Fprintln(w)
+		}
+		for _, timings := range []struct {
+			title    string
+			profiles []*TaskStepProfile
+		}{
+			{title: "Job queue times", profiles: workflow.JobQueues},
+			{title: jobStartOffsetsTitle, profiles: workflow.JobStartOffsets},
+		} {
+			if len(timings.profiles) == 0 {
+				continue
+			}
+			fmt.Fprintln(w, timings.title)
+			fmt.Fprintln(w, strings.Join(taskStepProfileHeader, "\t"))
+			for _, p := range timings.profiles {
+				fmt.Fprintln(w, strings.Join(taskStepProfileRow(p), "\t"))
+			}
+			fmt.Fprintln(w)
+		}
+		for _, p := range workflow.Jobs {
+			if p.Profile == nil {
+				continue
+			}
+			fmt.Fprintf(w, "Job: %s\n", p.Name)
+			fmt.Fprintln(w, "Number\tExecuted\tSkipped\tIncomplete\tMin\tMedian\tMean\tP50\tP90\tP95\tP99\tMax\tName")
+			for _, p := range p.Profile {
+				fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t%s\n", p.Number, p.Executed, p.Skipped, p.Incomplete, p.Min, p.Median, p.Mean, p.Percentiles[50].Value, p.Percentiles[90].Value, p.Percentiles[95].Value, p.Percentiles[99].Value, p.Max, taskStepDisplayName(p))
+			}
+			fmt.Fprintln(w)
+		}
+		if revisions := revisionsEndingAt(profileResult, i); len(revisions) > 1 {
+			fmt.Fprintf(w, "Revisions: %s\n", revisionComparisonTitle(revisions))
+			fmt.Fprintln(w)
+			header, rows := revisionComparison(revisions)
+			fmt.Fprintln(w, strings.Join(header, "\t"))
+			for _, row := range rows {
+				fmt.Fprintln(w, strings.Join(row, "\t"))
+			}
+			fmt.Fprintln(w)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,34 @@
+package ghaprofiler
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// openLocalRepository opens the git repository of the current directory, which may be a subdirectory of it,
+// and returns it with the URL of the remote
+func openLocalRepository(remoteName string) (*git.Repository, *RemoteURL, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, nil, err
+	}
+	repo, err := git.PlainOpenWithOptions(cwd, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	remote, err := repo.Remote(remoteName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", remoteName, err)
+	}
+	urls := remote.Config().URLs
+	if len(urls) == 0 {
+		return nil, nil, fmt.Errorf("%s: no URL", remoteName)
+	}
+	remoteURL, err := ParseRemoteURL(urls[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", remoteName, err)
+	}
+	return repo, remoteURL, nil
+}
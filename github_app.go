@@ -0,0 +1,154 @@
+package ghaprofiler
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// GitHub accepts a JWT which expires within 10 minutes
+	appJWTLifetime = 9 * time.Minute
+	// allow clock drift between the host and GitHub
+	appJWTClockSkew = 1 * time.Minute
+	// refresh an installation access token this long before it expires
+	appTokenRefreshMargin = 5 * time.Minute
+)
+
+// appTokenSource issues installation access tokens of a GitHub App
+type appTokenSource struct {
+	appID          int64
+	installationID int64
+	privateKey     *rsa.PrivateKey
+	apiBaseURL     string
+	httpClient     *http.Client
+	now            func() time.Time
+}
+
+// newAppTokenSource returns a token source which refreshes an installation access token before it expires
+func newAppTokenSource(appID, installationID int64, privateKeyPEM []byte, apiBaseURL string) (oauth2.TokenSource, error) {
+	privateKey, err := parseRSAPrivateKeyPEM(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	src := &appTokenSource{
+		appID:          appID,
+		installationID: installationID,
+		privateKey:     privateKey,
+		apiBaseURL:     apiBaseURL,
+		httpClient:     &http.Client{Timeout: 30 * time.Second},
+		now:            time.Now,
+	}
+	return oauth2.ReuseTokenSource(nil, src), nil
+}
+
+func parseRSAPrivateKeyPEM(p []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(p)
+	if block == nil {
+		return nil, fmt.Errorf("Private key of GitHub App is not PEM")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse private key of GitHub App")
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("Private key of GitHub App is not RSA")
+	}
+	return rsaKey, nil
+}
+
+// jwt returns a JSON Web Token to authenticate as the GitHub App
+func (s *appTokenSource) jwt() (string, error) {
+	now := s.now()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]int64{
+		"iat": now.Add(-appJWTClockSkew).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": s.appID,
+	})
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hashed := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.privateKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (s *appTokenSource) Token() (*oauth2.Token, error) {
+	jwt, err := s.jwt()
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%sapp/installations/%d/access_tokens", s.apiBaseURL, s.installationID)
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to issue an installation access token")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("Failed to issue an installation access token: %s", resp.Status)
+	}
+
+	var body struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, errors.Wrap(err, "failed to decode an installation access token")
+	}
+	return &oauth2.Token{
+		AccessToken: body.Token,
+		Expiry:      body.ExpiresAt.Add(-appTokenRefreshMargin),
+	}, nil
+}
+
+// apiBaseURL normalizes BaseURL in the same way as github.NewEnterpriseClient
+func (config *ClientConfig) apiBaseURL() (string, error) {
+	if config.BaseURL == "" {
+		return "https://" + defaultAPIHost + "/", nil
+	}
+	baseURL, err := url.Parse(config.BaseURL)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasSuffix(baseURL.Path, "/") {
+		baseURL.Path += "/"
+	}
+	if !strings.HasSuffix(baseURL.Path, "/api/v3/") {
+		baseURL.Path += "api/v3/"
+	}
+	return baseURL.String(), nil
+}
@@ -0,0 +1,168 @@
+package ghaprofiler
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestPrivateKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return key, p
+}
+
+// newTestAppServer serves installation access tokens which expire after lifetime
+// and verifies JWTs signed by key
+func newTestAppServer(t *testing.T, key *rsa.PrivateKey, lifetime time.Duration, issued *int32) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/app/installations/42/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("unexpected method %s", r.Method)
+		}
+		jwt := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		parts := strings.Split(jwt, ".")
+		if len(parts) != 3 {
+			t.Fatalf("malformed JWT: %s", jwt)
+		}
+		hashed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hashed[:], signature); err != nil {
+			t.Errorf("invalid signature: %v", err)
+		}
+		payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		var claims map[string]int64
+		if err := json.Unmarshal(payload, &claims); err != nil {
+			t.Fatal(err)
+		}
+		if claims["iss"] != 12345 {
+			t.Errorf("expected iss 12345, got %d", claims["iss"])
+		}
+		if claims["exp"]-claims["iat"] > int64((10 * time.Minute).Seconds()) {
+			t.Errorf("JWT must expire within 10 minutes")
+		}
+
+		n := atomic.AddInt32(issued, 1)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":      fmt.Sprintf("installation-token-%d", n),
+			"expires_at": time.Now().Add(lifetime).UTC().Format(time.RFC3339),
+		})
+	})
+	mux.HandleFunc("/api/v3/repos/owner/repo/actions/workflows", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer installation-token-1" {
+			t.Errorf("unexpected Authorization header: %s", got)
+		}
+		w.Write([]byte(`{"total_count":0,"workflows":[]}`))
+	})
+	return httptest.NewServer(mux)
+}
+
+func Test_AppTokenSourceReusesToken(t *testing.T) {
+	key, p := newTestPrivateKey(t)
+	var issued int32
+	server := newTestAppServer(t, key, time.Hour, &issued)
+	defer server.Close()
+
+	ts, err := newAppTokenSource(12345, 42, p, server.URL+"/api/v3/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		token, err := ts.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.AccessToken != "installation-token-1" {
+			t.Errorf("unexpected token %s", token.AccessToken)
+		}
+		if time.Until(token.Expiry) > time.Hour-appTokenRefreshMargin {
+			t.Errorf("token must be refreshed before it expires, but expiry is %v", token.Expiry)
+		}
+	}
+	if issued != 1 {
+		t.Errorf("expected 1 token issued, got %d", issued)
+	}
+}
+
+func Test_AppTokenSourceRefreshesToken(t *testing.T) {
+	key, p := newTestPrivateKey(t)
+	var issued int32
+	// tokens which expire within the refresh margin are renewed every time
+	server := newTestAppServer(t, key, appTokenRefreshMargin/2, &issued)
+	defer server.Close()
+
+	ts, err := newAppTokenSource(12345, 42, p, server.URL+"/api/v3/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := ts.Token(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if issued != 2 {
+		t.Errorf("expected 2 tokens issued, got %d", issued)
+	}
+}
+
+func Test_NewClientWithConfigAsGitHubApp(t *testing.T) {
+	key, p := newTestPrivateKey(t)
+	var issued int32
+	server := newTestAppServer(t, key, time.Hour, &issued)
+	defer server.Close()
+
+	client, err := NewClientWithConfig(context.Background(), &ClientConfig{
+		AppID:             12345,
+		AppInstallationID: 42,
+		AppPrivateKey:     p,
+		BaseURL:           server.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ListAllWorkflows(context.Background(), "owner", "repo"); err != nil {
+		t.Fatal(err)
+	}
+	if issued != 1 {
+		t.Errorf("expected 1 token issued, got %d", issued)
+	}
+}
+
+func Test_ParseRSAPrivateKeyPEM(t *testing.T) {
+	key, pkcs1 := newTestPrivateKey(t)
+	pkcs8Bytes, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8 := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8Bytes})
+
+	for _, p := range [][]byte{pkcs1, pkcs8} {
+		parsed, err := parseRSAPrivateKeyPEM(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.N.Cmp(key.N) != 0 {
+			t.Error("parsed key differs from the original")
+		}
+	}
+	if _, err := parseRSAPrivateKeyPEM([]byte("not a PEM")); err == nil {
+		t.Error("expected an error for invalid PEM")
+	}
+}
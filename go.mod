@@ -12,6 +12,8 @@ require (
 	github.com/pelletier/go-toml v1.8.1
 	github.com/peterbourgon/diskv v2.0.1+incompatible // indirect
 	github.com/pkg/errors v0.9.1
+	go.etcd.io/bbolt v1.3.6
 	golang.org/x/oauth2 v0.0.0-20201109201403-9fd604954f58
 	golang.org/x/sync v0.0.0-20200625203802-6e8e738ad208
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,146 @@
+package ghaprofiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/gregjones/httpcache"
+)
+
+// immutableCacheDirectoryName is the directory under the cache directory of a host for ImmutableCache
+const immutableCacheDirectoryName = "immutable"
+
+// ImmutableCache stores data which never change, such as jobs of completed workflow runs.
+// Entries are served without any request, so a key must change whenever the data may change.
+type ImmutableCache struct {
+	directory string
+}
+
+func NewImmutableCache(directory string) *ImmutableCache {
+	return &ImmutableCache{directory: directory}
+}
+
+func (c *ImmutableCache) path(key string) string {
+	return filepath.Join(c.directory, filepath.FromSlash(key)+".json")
+}
+
+// Get decodes the entry of key into v, and reports whether the entry exists
+func (c *ImmutableCache) Get(key string, v interface{}) (bool, error) {
+	path := c.path(key)
+	p, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	touchCacheEntry(path)
+	if err := json.Unmarshal(p, v); err != nil {
+		// a broken entry is treated as missing, and overwritten later
+		return false, nil
+	}
+	return true, nil
+}
+
+// Set stores v as the entry of key
+func (c *ImmutableCache) Set(key string, v interface{}) error {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// write to a temporary file and rename it so that a reader never sees a partial entry
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(p); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// workflowJobsCacheKey identifies jobs of a workflow run.
+// updated_at of the run changes on a re-run, so jobs of the previous attempt are never served for it.
+func workflowJobsCacheKey(owner, repo string, run *github.WorkflowRun, allAttempts bool) string {
+	filter := "latest"
+	if allAttempts {
+		filter = "all"
+	}
+	return fmt.Sprintf("%s/%s/runs/%d/jobs-%s-%d", owner, repo, run.GetID(), filter, run.GetUpdatedAt().Unix())
+}
+
+// workflowRevisionCacheKey identifies the revision of a workflow file at a commit, which never changes
+func workflowRevisionCacheKey(owner, repo, workflowFileName, commitSHA string) string {
+	return fmt.Sprintf("%s/%s/commits/%s/workflows/%s", owner, repo, commitSHA, workflowFileName)
+}
+
+// workflowFileContentCacheKey identifies the content of a revision of a workflow file, which never changes
+func workflowFileContentCacheKey(owner, repo, revision string) string {
+	return fmt.Sprintf("%s/%s/blobs/%s", owner, repo, revision)
+}
+
+// isImmutableWorkflowRun reports whether the workflow run and its jobs never change until a re-run
+func isImmutableWorkflowRun(run *github.WorkflowRun, jobs []*github.WorkflowJob) bool {
+	if run.GetStatus() != "completed" || run.UpdatedAt == nil {
+		return false
+	}
+	for _, job := range jobs {
+		if job.GetStatus() != "completed" {
+			return false
+		}
+	}
+	return true
+}
+
+// uncachedPathPattern matches endpoints of a single workflow run or its jobs.
+// They are stored in ImmutableCache once completed, and must not be cached while in progress.
+var uncachedPathPattern = regexp.MustCompile(`/actions/(runs/\d+(/jobs)?|jobs/\d+)$`)
+
+// cachePolicyTransport sends requests to list endpoints through the HTTP cache, which revalidates
+// responses with ETag, and the other requests directly to the network
+type cachePolicyTransport struct {
+	Cache     http.RoundTripper
+	Transport http.RoundTripper
+	// Observer is notified of responses served from the cache if set
+	Observer CacheObserver
+}
+
+// CacheObserver is notified of every response served from the cache without consuming the rate limit
+type CacheObserver interface {
+	ObserveCacheHit()
+}
+
+func (t *cachePolicyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isCacheableRequest(req) {
+		return t.Transport.RoundTrip(req)
+	}
+	resp, err := t.Cache.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if t.Observer != nil && resp.Header.Get(httpcache.XFromCache) != "" {
+		t.Observer.ObserveCacheHit()
+	}
+	return resp, nil
+}
+
+func isCacheableRequest(req *http.Request) bool {
+	return !uncachedPathPattern.MatchString(strings.TrimSuffix(req.URL.Path, "/"))
+}
@@ -0,0 +1,265 @@
+package ghaprofiler
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+func Test_ImmutableCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "immutable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cache := NewImmutableCache(dir)
+
+	var got []int
+	if ok, err := cache.Get("owner/repo/key", &got); err != nil || ok {
+		t.Fatalf("expected no entry, got ok=%v, err=%v", ok, err)
+	}
+	if err := cache.Set("owner/repo/key", []int{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := cache.Get("owner/repo/key", &got); err != nil || !ok {
+		t.Fatalf("expected an entry, got ok=%v, err=%v", ok, err)
+	}
+	if len(got) != 3 || got[2] != 3 {
+		t.Fatalf("unexpected entry: %v", got)
+	}
+}
+
+func Test_ListAllWorkflowJobsOfRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	jobStatus := "completed"
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// GitHub allows clients to cache responses for a while
+		w.Header().Set("Cache-Control", "private, max-age=60, s-maxage=60")
+		w.Header().Set("ETag", `"etag"`)
+		json.NewEncoder(w).Encode(&github.Jobs{
+			Jobs: []*github.WorkflowJob{{ID: github.Int64(1), Status: github.String(jobStatus)}},
+		})
+	}))
+	defer server.Close()
+
+	client, err := NewClientWithConfig(context.Background(), &ClientConfig{
+		BaseURL:        server.URL,
+		Cache:          true,
+		CacheDirectory: dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRun := func(status string, updatedAt time.Time) *github.WorkflowRun {
+		return &github.WorkflowRun{
+			ID:        github.Int64(1),
+			Status:    github.String(status),
+			UpdatedAt: &github.Timestamp{Time: updatedAt},
+		}
+	}
+	listJobs := func(run *github.WorkflowRun) {
+		jobs, err := client.ListAllWorkflowJobsOfRun(context.Background(), "owner", "repo", run, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(jobs) != 1 {
+			t.Fatalf("expected 1 job, got %d", len(jobs))
+		}
+	}
+
+	// jobs of an in-progress run are neither cached by the HTTP cache
+	jobStatus = "in_progress"
+	listJobs(newRun("in_progress", testBaseTime))
+	listJobs(newRun("in_progress", testBaseTime))
+	if requests != 2 {
+		t.Fatalf("expected 2 requests for an in-progress run, got %d", requests)
+	}
+
+	// nor by the immutable cache while a job is in progress
+	listJobs(newRun("completed", testBaseTime))
+	if requests != 3 {
+		t.Fatalf("expected 3 requests, got %d", requests)
+	}
+
+	jobStatus = "completed"
+	listJobs(newRun("completed", testBaseTime))
+	listJobs(newRun("completed", testBaseTime))
+	if requests != 4 {
+		t.Fatalf("expected jobs of a completed run served from the cache, got %d requests", requests)
+	}
+
+	// a re-run updates the run
+	listJobs(newRun("completed", testBaseTime.Add(time.Hour)))
+	if requests != 5 {
+		t.Fatalf("expected jobs of a re-run requested, got %d requests", requests)
+	}
+}
+
+func Test_ListAllWorkflowJobsOfRunUnwritableCache(t *testing.T) {
+	f, err := ioutil.TempFile("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	client, teardown := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.Jobs{
+			Jobs: []*github.WorkflowJob{{ID: github.Int64(1), Status: github.String("completed")}},
+		})
+	}))
+	defer teardown()
+	// a directory cannot be created under a file
+	client.immutableCache = NewImmutableCache(filepath.Join(f.Name(), "immutable"))
+
+	run := &github.WorkflowRun{ID: github.Int64(1), Status: github.String("completed"), UpdatedAt: &github.Timestamp{Time: testBaseTime}}
+	jobs, err := client.ListAllWorkflowJobsOfRun(context.Background(), "owner", "repo", run, false)
+	if err != nil {
+		t.Fatalf("expected jobs returned without the cache, got %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("expected 1 job, got %d", len(jobs))
+	}
+	revision, err := client.GetWorkflowFileRevision(context.Background(), "owner", "repo", "ci.yml", "abc")
+	if err != nil || revision != "" {
+		t.Fatalf("expected no revision without the cache, got %q, %v", revision, err)
+	}
+}
+
+func Test_IsCacheableRequest(t *testing.T) {
+	testCases := []struct {
+		url      string
+		expected bool
+	}{
+		{"https://api.github.com/repos/o/r/actions/workflows/ci.yml/runs?per_page=100", true},
+		{"https://api.github.com/repos/o/r/actions/workflows", true},
+		{"https://api.github.com/orgs/o/repos", true},
+		{"https://api.github.com/repos/o/r/actions/runs/1/jobs?filter=all", false},
+		{"https://github.example.com/api/v3/repos/o/r/actions/runs/1", false},
+		{"https://api.github.com/repos/o/r/actions/jobs/1", false},
+	}
+	for _, tc := range testCases {
+		req, err := http.NewRequest("GET", tc.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := isCacheableRequest(req); got != tc.expected {
+			t.Errorf("%s: expected %v, got %v", tc.url, tc.expected, got)
+		}
+	}
+}
+
+func Test_GetWorkflowFileRevision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if !strings.HasSuffix(r.URL.Path, "/repos/owner/repo/contents/.github/workflows/ci.yml") {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"message": "Not Found"})
+			return
+		}
+		if ref := r.URL.Query().Get("ref"); ref != "abc" {
+			t.Errorf("unexpected ref: %s", ref)
+		}
+		json.NewEncoder(w).Encode(&github.RepositoryContent{
+			Type: github.String("file"),
+			Path: github.String(".github/workflows/ci.yml"),
+			SHA:  github.String("blob"),
+		})
+	}))
+	defer server.Close()
+
+	client, err := NewClientWithConfig(context.Background(), &ClientConfig{
+		BaseURL:        server.URL,
+		Cache:          true,
+		CacheDirectory: dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		workflowFileName string
+		expected         string
+	}{
+		{workflowFileName: "ci.yml", expected: "blob"},
+		// the workflow file does not exist at the commit
+		{workflowFileName: "release.yml", expected: ""},
+	} {
+		// served by the immutable cache for the second time
+		for i := 0; i < 2; i++ {
+			revision, err := client.GetWorkflowFileRevision(context.Background(), "owner", "repo", tc.workflowFileName, "abc")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if revision != tc.expected {
+				t.Errorf("%s: expected %q, got %q", tc.workflowFileName, tc.expected, revision)
+			}
+		}
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+}
+
+func Test_GetWorkflowFileContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if !strings.HasSuffix(r.URL.Path, "/repos/owner/repo/git/blobs/blob") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("jobs: {}\n"))
+	}))
+	defer server.Close()
+
+	client, err := NewClientWithConfig(context.Background(), &ClientConfig{
+		BaseURL:        server.URL,
+		Cache:          true,
+		CacheDirectory: dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// served by the immutable cache for the second time
+	for i := 0; i < 2; i++ {
+		content, err := client.GetWorkflowFileContent(context.Background(), "owner", "repo", "blob")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != "jobs: {}\n" {
+			t.Errorf("unexpected content: %q", content)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expected 1 request, got %d", requests)
+	}
+}
@@ -0,0 +1,342 @@
+package ghaprofiler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// LoadWorkflowRuns reads workflow runs and jobs from one of the following formats
+// (optionally gzipped), without any access to GitHub:
+//
+//   - an archive written with record option
+//   - output of `gh run view --json jobs` (with optional databaseId, workflowName, createdAt, ...)
+//   - output of `gh api` for workflow runs, jobs of a workflow run or a job (also with --paginate)
+//
+// defaultRepository and defaultWorkflowFileName are used when the input does not tell them.
+func LoadWorkflowRuns(r io.Reader, defaultRepository, defaultWorkflowFileName string) ([]*WorkflowRunWithJobs, error) {
+	bufferedReader := bufio.NewReader(r)
+	magic, _ := bufferedReader.Peek(2)
+	var reader io.Reader = bufferedReader
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gzipReader, err := gzip.NewReader(bufferedReader)
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	loader := &workflowRunLoader{
+		defaultRepository:       defaultRepository,
+		defaultWorkflowFileName: defaultWorkflowFileName,
+		runByID:                 make(map[int64]*WorkflowRunWithJobs),
+	}
+	decoder := json.NewDecoder(reader)
+	for {
+		var document map[string]json.RawMessage
+		err := decoder.Decode(&document)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := loader.load(document); err != nil {
+			return nil, err
+		}
+	}
+	return loader.runs, nil
+}
+
+// LoadWorkflowRunsFromFile is LoadWorkflowRuns for a file.
+// The file name is used as the workflow file name if neither the input nor defaultWorkflowFileName tells it.
+func LoadWorkflowRunsFromFile(filename, defaultRepository, defaultWorkflowFileName string) ([]*WorkflowRunWithJobs, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if defaultWorkflowFileName == "" {
+		defaultWorkflowFileName = filepath.Base(filename)
+	}
+	runs, err := LoadWorkflowRuns(f, defaultRepository, defaultWorkflowFileName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load %s: %v", filename, err)
+	}
+	return runs, nil
+}
+
+type workflowRunLoader struct {
+	defaultRepository       string
+	defaultWorkflowFileName string
+	runs                    []*WorkflowRunWithJobs
+	runByID                 map[int64]*WorkflowRunWithJobs
+	// runs of gh run view without databaseId have pseudo IDs counting down from -1
+	lastPseudoRunID int64
+}
+
+func (l *workflowRunLoader) load(document map[string]json.RawMessage) error {
+	switch {
+	case document["manifest"] != nil:
+		var line archiveLine
+		if err := unmarshalDocument(document, &line); err != nil {
+			return err
+		}
+		if line.Manifest.Version != archiveVersion {
+			return fmt.Errorf("Unsupported archive version: %d", line.Manifest.Version)
+		}
+		return nil
+	case document["workflow_run"] != nil:
+		var line archiveLine
+		if err := unmarshalDocument(document, &line); err != nil {
+			return err
+		}
+		if line.WorkflowRun == nil {
+			return fmt.Errorf("Workflow run is missing in the archive")
+		}
+		l.addRun(line.WorkflowRun)
+		return nil
+	case document["workflow_runs"] != nil:
+		var runs WorkflowRuns
+		if err := unmarshalDocument(document, &runs); err != nil {
+			return err
+		}
+		for _, run := range runs.WorkflowRuns {
+			if run == nil || run.WorkflowRun == nil {
+				continue
+			}
+			loaded := l.runFor(run.GetID(), repositoryFromRun(run.WorkflowRun))
+			loaded.Run = run.WorkflowRun
+			loaded.WorkflowRunAttempt = run.WorkflowRunAttempt
+		}
+		return nil
+	case document["jobs"] != nil:
+		var jobs []map[string]json.RawMessage
+		if err := json.Unmarshal(document["jobs"], &jobs); err != nil {
+			return err
+		}
+		if len(jobs) > 0 && jobs[0]["run_id"] == nil && jobs[0]["started_at"] == nil {
+			return l.loadGHRunView(document)
+		}
+		for _, job := range jobs {
+			if err := l.loadJob(job); err != nil {
+				return err
+			}
+		}
+		return nil
+	case document["steps"] != nil && document["run_id"] != nil:
+		return l.loadJob(document)
+	}
+	return fmt.Errorf("Unsupported input")
+}
+
+func unmarshalDocument(document map[string]json.RawMessage, v interface{}) error {
+	p, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(p, v)
+}
+
+// runFor returns the run of runID, creating it if it does not exist yet
+func (l *workflowRunLoader) runFor(runID int64, repository string) *WorkflowRunWithJobs {
+	if run, ok := l.runByID[runID]; ok {
+		return run
+	}
+	if repository == "" {
+		repository = l.defaultRepository
+	}
+	run := &WorkflowRunWithJobs{
+		Repository:       repository,
+		WorkflowFileName: l.defaultWorkflowFileName,
+		Run:              &github.WorkflowRun{ID: github.Int64(runID)},
+	}
+	l.runByID[runID] = run
+	l.runs = append(l.runs, run)
+	return run
+}
+
+// addRun adds a workflow run of an archive, which replaces the run of the same ID loaded so far
+// except for jobs which the archive does not have
+func (l *workflowRunLoader) addRun(run *WorkflowRunWithJobs) {
+	if run.Run == nil {
+		l.runs = append(l.runs, run)
+		return
+	}
+	loaded, ok := l.runByID[run.Run.GetID()]
+	if !ok {
+		l.runByID[run.Run.GetID()] = run
+		l.runs = append(l.runs, run)
+		return
+	}
+	jobs := loaded.Jobs
+	*loaded = *run
+	loaded.Jobs = nil
+	addWorkflowJobs(loaded, run.Jobs)
+	addWorkflowJobs(loaded, jobs)
+}
+
+// addWorkflowJobs adds jobs to run except ones which run already has
+func addWorkflowJobs(run *WorkflowRunWithJobs, jobs []*github.WorkflowJob) {
+	jobIDs := make(map[int64]bool)
+	for _, job := range run.Jobs {
+		if job.ID != nil {
+			jobIDs[job.GetID()] = true
+		}
+	}
+	for _, job := range jobs {
+		if job.ID != nil {
+			if jobIDs[job.GetID()] {
+				continue
+			}
+			jobIDs[job.GetID()] = true
+		}
+		run.Jobs = append(run.Jobs, job)
+	}
+}
+
+// loadJob loads a job in the format of GitHub REST API
+func (l *workflowRunLoader) loadJob(document map[string]json.RawMessage) error {
+	var job github.WorkflowJob
+	if err := unmarshalDocument(document, &job); err != nil {
+		return err
+	}
+	run := l.runFor(job.GetRunID(), repositoryFromURL(job.GetRunURL()))
+	addWorkflowJobs(run, []*github.WorkflowJob{&job})
+	return nil
+}
+
+var repositoryURLRegexp = regexp.MustCompile(`/repos/([^/]+)/([^/]+)/`)
+
+// repositoryFromURL extracts owner/repo from a URL of GitHub REST API
+func repositoryFromURL(url string) string {
+	m := repositoryURLRegexp.FindStringSubmatch(url)
+	if m == nil {
+		return ""
+	}
+	return m[1] + "/" + m[2]
+}
+
+func repositoryFromRun(run *github.WorkflowRun) string {
+	if run.GetRepository().GetFullName() != "" {
+		return run.GetRepository().GetFullName()
+	}
+	return repositoryFromURL(run.GetURL())
+}
+
+// ghRunView is output of `gh run view --json`
+type ghRunView struct {
+	DatabaseID   int64       `json:"databaseId"`
+	Attempt      int         `json:"attempt"`
+	WorkflowName string      `json:"workflowName"`
+	HeadBranch   string      `json:"headBranch"`
+	HeadSHA      string      `json:"headSha"`
+	Event        string      `json:"event"`
+	Status       string      `json:"status"`
+	Conclusion   string      `json:"conclusion"`
+	CreatedAt    time.Time   `json:"createdAt"`
+	StartedAt    time.Time   `json:"startedAt"`
+	UpdatedAt    time.Time   `json:"updatedAt"`
+	URL          string      `json:"url"`
+	Jobs         []*ghRunJob `json:"jobs"`
+}
+
+type ghRunJob struct {
+	DatabaseID  int64        `json:"databaseId"`
+	Name        string       `json:"name"`
+	Status      string       `json:"status"`
+	Conclusion  string       `json:"conclusion"`
+	StartedAt   time.Time    `json:"startedAt"`
+	CompletedAt time.Time    `json:"completedAt"`
+	URL         string       `json:"url"`
+	Steps       []*ghRunStep `json:"steps"`
+}
+
+type ghRunStep struct {
+	Name        string    `json:"name"`
+	Number      int64     `json:"number"`
+	Status      string    `json:"status"`
+	Conclusion  string    `json:"conclusion"`
+	StartedAt   time.Time `json:"startedAt"`
+	CompletedAt time.Time `json:"completedAt"`
+}
+
+var htmlRepositoryURLRegexp = regexp.MustCompile(`^https?://[^/]+/([^/]+)/([^/]+)/actions/runs/`)
+
+func (l *workflowRunLoader) loadGHRunView(document map[string]json.RawMessage) error {
+	var view ghRunView
+	if err := unmarshalDocument(document, &view); err != nil {
+		return err
+	}
+
+	runID := view.DatabaseID
+	if runID == 0 {
+		l.lastPseudoRunID--
+		runID = l.lastPseudoRunID
+	}
+	var repository string
+	if m := htmlRepositoryURLRegexp.FindStringSubmatch(view.URL); m != nil {
+		repository = m[1] + "/" + m[2]
+	}
+	run := l.runFor(runID, repository)
+	run.Run.HeadBranch = stringOrNil(view.HeadBranch)
+	run.Run.HeadSHA = stringOrNil(view.HeadSHA)
+	run.Run.Event = stringOrNil(view.Event)
+	run.Run.Status = stringOrNil(view.Status)
+	run.Run.Conclusion = stringOrNil(view.Conclusion)
+	run.Run.CreatedAt = timestampOrNil(view.CreatedAt)
+	run.Run.UpdatedAt = timestampOrNil(view.UpdatedAt)
+	run.Run.HTMLURL = stringOrNil(view.URL)
+	run.RunAttempt = view.Attempt
+	run.RunStartedAt = timestampOrNil(view.StartedAt)
+
+	for _, ghJob := range view.Jobs {
+		job := &github.WorkflowJob{
+			ID:          github.Int64(ghJob.DatabaseID),
+			RunID:       github.Int64(runID),
+			Name:        github.String(ghJob.Name),
+			Status:      stringOrNil(ghJob.Status),
+			Conclusion:  stringOrNil(ghJob.Conclusion),
+			StartedAt:   timestampOrNil(ghJob.StartedAt),
+			CompletedAt: timestampOrNil(ghJob.CompletedAt),
+			HTMLURL:     stringOrNil(ghJob.URL),
+		}
+		for _, ghStep := range ghJob.Steps {
+			job.Steps = append(job.Steps, &github.TaskStep{
+				Name:        github.String(ghStep.Name),
+				Number:      github.Int64(ghStep.Number),
+				Status:      stringOrNil(ghStep.Status),
+				Conclusion:  stringOrNil(ghStep.Conclusion),
+				StartedAt:   timestampOrNil(ghStep.StartedAt),
+				CompletedAt: timestampOrNil(ghStep.CompletedAt),
+			})
+		}
+		run.Jobs = append(run.Jobs, job)
+	}
+	return nil
+}
+
+func stringOrNil(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// timestampOrNil treats zero time, which gh outputs for missing timestamps, as nil
+func timestampOrNil(t time.Time) *github.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return &github.Timestamp{Time: t}
+}
@@ -0,0 +1,127 @@
+package ghaprofiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+func Test_LoadWorkflowRuns_GHRunView(t *testing.T) {
+	runs, err := LoadWorkflowRunsFromFile("fixtures/gh-run-view.json", "", "ci.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("expected 1 run, got %d", len(runs))
+	}
+	run := runs[0]
+	if run.Repository != "utgwkk/Twitter-Text" || run.WorkflowFileName != "ci.yml" {
+		t.Fatalf("unexpected run: %#v", run)
+	}
+	if run.Run.GetID() != 412345678 || run.Run.GetHeadBranch() != "main" || run.Run.GetCreatedAt().Time.IsZero() {
+		t.Fatalf("unexpected run: %#v", run.Run)
+	}
+	if run.RunAttempt != 1 || run.RunStartedAt == nil {
+		t.Fatalf("unexpected attempt: %#v", run.WorkflowRunAttempt)
+	}
+	if len(run.Jobs) != 1 || len(run.Jobs[0].Steps) != 3 {
+		t.Fatalf("unexpected jobs: %#v", run.Jobs)
+	}
+	skipped := run.Jobs[0].Steps[2]
+	if skipped.StartedAt != nil || skipped.CompletedAt != nil {
+		t.Fatal("zero timestamps must be nil")
+	}
+}
+
+func Test_LoadWorkflowRuns_GHAPIPaginatedJobs(t *testing.T) {
+	runs, err := LoadWorkflowRunsFromFile("fixtures/gh-api-jobs.json", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("expected 1 run, got %d", len(runs))
+	}
+	run := runs[0]
+	if run.Repository != "utgwkk/Twitter-Text" || run.WorkflowFileName != "gh-api-jobs.json" {
+		t.Fatalf("unexpected run: %#v", run)
+	}
+	if len(run.Jobs) != 2 {
+		t.Fatalf("expected 2 jobs, got %d", len(run.Jobs))
+	}
+}
+
+func Test_LoadWorkflowRuns_Archive(t *testing.T) {
+	runs := []*WorkflowRunWithJobs{
+		{
+			Repository:       "utgwkk/Twitter-Text",
+			WorkflowFileName: "ci.yml",
+			Run:              &github.WorkflowRun{ID: github.Int64(1)},
+		},
+	}
+	var buf bytes.Buffer
+	if err := WriteArchive(&buf, NewArchiveManifest(runs, time.Now()), runs); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadWorkflowRuns(&buf, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 1 || loaded[0].WorkflowFileName != "ci.yml" || loaded[0].Run.GetID() != 1 {
+		t.Fatalf("unexpected runs: %#v", loaded)
+	}
+}
+
+func Test_LoadWorkflowRuns_ArchiveWithGHAPI(t *testing.T) {
+	runs := []*WorkflowRunWithJobs{
+		{
+			Repository:       "utgwkk/Twitter-Text",
+			WorkflowFileName: "ci.yml",
+			Run:              &github.WorkflowRun{ID: github.Int64(1)},
+			Jobs:             []*github.WorkflowJob{{ID: github.Int64(10), RunID: github.Int64(1)}},
+		},
+	}
+	var buf bytes.Buffer
+	if err := WriteArchive(&buf, NewArchiveManifest(runs, time.Now()), runs); err != nil {
+		t.Fatal(err)
+	}
+	// lines of the archive are mixed with output of gh api
+	gzipReader, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := ioutil.ReadAll(gzipReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ghAPI := `{"workflow_runs": [{"id": 1, "head_branch": "main"}]}
+{"total_count": 2, "jobs": [{"id": 10, "run_id": 1, "started_at": "2020-12-01T00:00:00Z"}, {"id": 11, "run_id": 1, "started_at": "2020-12-01T00:00:00Z"}]}
+`
+
+	for _, input := range []string{string(archive) + ghAPI, ghAPI + string(archive)} {
+		loaded, err := LoadWorkflowRuns(bytes.NewBufferString(input), "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(loaded) != 1 {
+			t.Fatalf("expected 1 run, got %d", len(loaded))
+		}
+		run := loaded[0]
+		if run.Repository != "utgwkk/Twitter-Text" || run.WorkflowFileName != "ci.yml" {
+			t.Fatalf("unexpected run: %#v", run)
+		}
+		if len(run.Jobs) != 2 || run.Jobs[0].GetID() != 10 || run.Jobs[1].GetID() != 11 {
+			t.Fatalf("unexpected jobs: %#v", run.Jobs)
+		}
+	}
+}
+
+func Test_LoadWorkflowRuns_Unsupported(t *testing.T) {
+	if _, err := LoadWorkflowRuns(bytes.NewBufferString(`{"foo": "bar"}`), "", ""); err == nil {
+		t.Fatal("Expected an error for unsupported input")
+	}
+}
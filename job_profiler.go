@@ -0,0 +1,104 @@
+package ghaprofiler
+
+import (
+	"github.com/google/go-github/v32/github"
+)
+
+// JobDurationProfile is statistics of durations of jobs with the same name in seconds
+type JobDurationProfile struct {
+	Min         float64                   `json:"min"`
+	Max         float64                   `json:"max"`
+	Median      float64                   `json:"median"`
+	Mean        float64                   `json:"mean"`
+	Percentiles map[int64]*percentileData `json:"percentiles"`
+	// Overhead is the mean of job durations minus the sum of durations of their steps,
+	// which is time not accounted for by any step such as preparing a runner
+	Overhead float64 `json:"overhead"`
+	Executed int     `json:"executed"`
+	Skipped  int     `json:"skipped"`
+}
+
+type ProfileJobDurationOptions struct {
+	// IncludeAllJobs includes skipped and cancelled jobs in timing statistics
+	IncludeAllJobs bool
+}
+
+const (
+	jobStatusCompleted     = "completed"
+	jobConclusionSkipped   = "skipped"
+	jobConclusionCancelled = "cancelled"
+)
+
+// isExecutedWorkflowJob reports whether the job ran to the end
+func isExecutedWorkflowJob(job *github.WorkflowJob) bool {
+	if job.GetStatus() != jobStatusCompleted {
+		return false
+	}
+	switch job.GetConclusion() {
+	case jobConclusionSkipped, jobConclusionCancelled:
+		return false
+	}
+	return true
+}
+
+// workflowJobElapsedSeconds returns false if the job does not have both timestamps
+func workflowJobElapsedSeconds(job *github.WorkflowJob) (float64, bool) {
+	if job.StartedAt == nil || job.CompletedAt == nil {
+		return 0, false
+	}
+	elapsed := job.CompletedAt.Sub(job.StartedAt.Time)
+	return float64(elapsed.Nanoseconds()) / 1e9, true
+}
+
+// ProfileJobDuration profiles durations of jobs, which are usually jobs with the same name
+func ProfileJobDuration(jobs []*github.WorkflowJob, opts *ProfileJobDurationOptions) (*JobDurationProfile, error) {
+	if opts == nil {
+		opts = &ProfileJobDurationOptions{}
+	}
+
+	var jobElapsed, overheads []float64
+	executed, skipped := 0, 0
+	for _, job := range jobs {
+		isExecuted := isExecutedWorkflowJob(job)
+		if isExecuted {
+			executed++
+		} else {
+			skipped++
+		}
+		if !isExecuted && !opts.IncludeAllJobs {
+			continue
+		}
+		elapsedSeconds, ok := workflowJobElapsedSeconds(job)
+		if !ok {
+			continue
+		}
+		jobElapsed = append(jobElapsed, elapsedSeconds)
+
+		var stepsElapsedSeconds float64
+		for _, step := range job.Steps {
+			if s, ok := taskStepElapsedSeconds(step); ok {
+				stepsElapsedSeconds += s
+			}
+		}
+		overheads = append(overheads, elapsedSeconds-stepsElapsedSeconds)
+	}
+
+	durationStats, err := calculateDurationStats(jobElapsed)
+	if err != nil {
+		return nil, err
+	}
+	overheadStats, err := calculateDurationStats(overheads)
+	if err != nil {
+		return nil, err
+	}
+	return &JobDurationProfile{
+		Min:         durationStats.Min,
+		Max:         durationStats.Max,
+		Median:      durationStats.Median,
+		Mean:        durationStats.Mean,
+		Percentiles: durationStats.Percentiles,
+		Overhead:    overheadStats.Mean,
+		Executed:    executed,
+		Skipped:     skipped,
+	}, nil
+}
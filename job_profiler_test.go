@@ -0,0 +1,74 @@
+package ghaprofiler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+func newTestWorkflowJob(status, conclusion string, elapsedSeconds int, steps ...*github.TaskStep) *github.WorkflowJob {
+	job := &github.WorkflowJob{
+		Status: github.String(status),
+		Steps:  steps,
+	}
+	if status == "queued" {
+		return job
+	}
+	job.StartedAt = &github.Timestamp{Time: testBaseTime}
+	if status != jobStatusCompleted {
+		return job
+	}
+	job.Conclusion = github.String(conclusion)
+	job.CompletedAt = &github.Timestamp{Time: testBaseTime.Add(time.Duration(elapsedSeconds) * time.Second)}
+	return job
+}
+
+func Test_ProfileJobDuration(t *testing.T) {
+	jobs := []*github.WorkflowJob{
+		newTestWorkflowJob("completed", "success", 60,
+			newTestTaskStep(1, "Set up job", "completed", "success", 5),
+			newTestTaskStep(2, "Test", "completed", "success", 45),
+		),
+		newTestWorkflowJob("completed", "failure", 30,
+			newTestTaskStep(1, "Set up job", "completed", "success", 4),
+			newTestTaskStep(2, "Test", "completed", "failure", 20),
+		),
+		newTestWorkflowJob("completed", "skipped", 0),
+		newTestWorkflowJob("in_progress", "", 0),
+	}
+
+	p, err := ProfileJobDuration(jobs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Executed != 2 || p.Skipped != 2 {
+		t.Fatalf("unexpected counts: executed=%d, skipped=%d", p.Executed, p.Skipped)
+	}
+	if p.Min != 30 || p.Max != 60 || p.Mean != 45 {
+		t.Fatalf("unexpected stats: min=%f, max=%f, mean=%f", p.Min, p.Max, p.Mean)
+	}
+	// (60 - 50 + 30 - 24) / 2
+	if p.Overhead != 8 {
+		t.Fatalf("expected overhead 8, got %f", p.Overhead)
+	}
+
+	p, err = ProfileJobDuration(jobs, &ProfileJobDurationOptions{IncludeAllJobs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the skipped job is included, and the job in progress has no duration yet
+	if p.Min != 0 || p.Mean != 30 {
+		t.Fatalf("unexpected stats: min=%f, mean=%f", p.Min, p.Mean)
+	}
+}
+
+func Test_ProfileJobDurationWithoutJobs(t *testing.T) {
+	p, err := ProfileJobDuration(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Executed != 0 || p.Mean != 0 || p.Percentiles[90] == nil {
+		t.Fatalf("unexpected profile: %+v", p)
+	}
+}
@@ -0,0 +1,169 @@
+package ghaprofiler
+
+import (
+	"sort"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// jobQueueTiming is when a job started and how long it waited for a runner in seconds
+type jobQueueTiming struct {
+	// startOffset is how long after the workflow run started the job started
+	startOffset float64
+	// queue is how long the job waited after the jobs it needs completed, which is valid if needsKnown is true
+	queue      float64
+	needsKnown bool
+}
+
+// estimateJobQueueTimings estimates how long each job of the workflow runs waited for a runner.
+// A job is ready when the workflow run started or, if later, when the last job of needs in the workflow file
+// completed. Jobs whose needs are unknown, as the revision of the workflow file is not loaded into graphs,
+// only have the time since the workflow run started.
+// Skipped jobs and jobs which have not started are not estimated.
+func estimateJobQueueTimings(workflowRuns []*WorkflowRunWithJobs, graphs map[workflowJobGraphKey]*workflowJobGraph) map[*github.WorkflowJob]*jobQueueTiming {
+	timings := make(map[*github.WorkflowJob]*jobQueueTiming)
+	for _, run := range workflowRuns {
+		runStartedAt, ok := workflowRunStartedAt(run)
+		if !ok {
+			continue
+		}
+		graph := graphs[workflowJobGraphKey{repository: run.Repository, revision: run.Revision}]
+		// jobs of a matrix share their ID
+		jobsByID := make(map[string][]*github.WorkflowJob)
+		jobIDs := make(map[*github.WorkflowJob]string)
+		if graph != nil {
+			for _, job := range run.Jobs {
+				if id, ok := graph.jobID(job.GetName()); ok {
+					jobsByID[id] = append(jobsByID[id], job)
+					jobIDs[job] = id
+				}
+			}
+		}
+
+		for _, job := range run.Jobs {
+			if job.StartedAt == nil || job.GetConclusion() == jobConclusionSkipped {
+				continue
+			}
+			timing := &jobQueueTiming{startOffset: job.StartedAt.Sub(runStartedAt).Seconds()}
+			timings[job] = timing
+			id, ok := jobIDs[job]
+			if !ok {
+				continue
+			}
+			readyAt := runStartedAt
+			for _, need := range graph.needs[id] {
+				for _, needed := range jobsByID[need] {
+					if needed.CompletedAt != nil && needed.CompletedAt.After(readyAt) {
+						readyAt = needed.CompletedAt.Time
+					}
+				}
+			}
+			timing.queue = job.StartedAt.Sub(readyAt).Seconds()
+			timing.needsKnown = true
+		}
+	}
+	return timings
+}
+
+// profileJobQueues profiles queue times of jobs whose needs are known with the same name as a TaskStepProfile
+// for each job name, where Number is the order in which jobs usually start and Skipped is the number of jobs
+// not estimated. It returns nil if jobs have started but needs of none of them are known.
+func profileJobQueues(jobsByJobName *jobsByJobNameMap, timings map[*github.WorkflowJob]*jobQueueTiming) (TaskStepProfileResult, error) {
+	return profileJobTimings(jobsByJobName, timings, true, func(timing *jobQueueTiming) (float64, bool) {
+		return timing.queue, timing.needsKnown
+	})
+}
+
+// profileJobStartOffsets profiles the time since the workflow run started of jobs whose needs are unknown
+// in the same way as profileJobQueues. It returns nil if needs of every started job are known.
+func profileJobStartOffsets(jobsByJobName *jobsByJobNameMap, timings map[*github.WorkflowJob]*jobQueueTiming) (TaskStepProfileResult, error) {
+	return profileJobTimings(jobsByJobName, timings, false, func(timing *jobQueueTiming) (float64, bool) {
+		return timing.startOffset, !timing.needsKnown
+	})
+}
+
+// profileJobTimings profiles values of timings which value returns. Jobs which have a timing without a value
+// are counted as neither executed nor skipped. It returns nil if no job has a value, unless no job has a timing
+// and keepUnestimated is true.
+func profileJobTimings(jobsByJobName *jobsByJobNameMap, timings map[*github.WorkflowJob]*jobQueueTiming, keepUnestimated bool, value func(*jobQueueTiming) (float64, bool)) (TaskStepProfileResult, error) {
+	var profileResult TaskStepProfileResult
+	meanStartOffsets := make(map[*TaskStepProfile]float64)
+	hasValue, hasTiming := false, false
+	for jobName, jobs := range jobsByJobName.Iterate() {
+		if len(jobs) == 0 {
+			continue
+		}
+		var queues []float64
+		var startOffsetSum float64
+		skipped := 0
+		conclusions := make(map[string]int)
+		for _, job := range jobs {
+			timing, ok := timings[job]
+			if !ok {
+				conclusions[workflowJobConclusion(job)]++
+				skipped++
+				continue
+			}
+			hasTiming = true
+			v, ok := value(timing)
+			if !ok {
+				continue
+			}
+			conclusions[workflowJobConclusion(job)]++
+			queues = append(queues, v)
+			startOffsetSum += timing.startOffset
+		}
+		if len(queues) > 0 {
+			hasValue = true
+		}
+
+		durationStats, err := calculateDurationStats(queues)
+		if err != nil {
+			return nil, err
+		}
+		profile := &TaskStepProfile{
+			Name:        jobName,
+			Min:         durationStats.Min,
+			Max:         durationStats.Max,
+			Median:      durationStats.Median,
+			Mean:        durationStats.Mean,
+			Percentiles: durationStats.Percentiles,
+			Executed:    len(queues),
+			Skipped:     skipped,
+			Conclusions: conclusions,
+		}
+		if len(queues) > 0 {
+			meanStartOffsets[profile] = startOffsetSum / float64(len(queues))
+		}
+		profileResult = append(profileResult, profile)
+	}
+
+	if !hasValue && (hasTiming || !keepUnestimated) {
+		return nil, nil
+	}
+
+	// jobs never started come last
+	sort.Slice(profileResult, func(i, j int) bool {
+		oi, iStarted := meanStartOffsets[profileResult[i]]
+		oj, jStarted := meanStartOffsets[profileResult[j]]
+		if iStarted != jStarted {
+			return iStarted
+		}
+		if oi != oj {
+			return oi < oj
+		}
+		return profileResult[i].Name < profileResult[j].Name
+	})
+	for i, profile := range profileResult {
+		profile.Number = int64(i + 1)
+	}
+	return profileResult, nil
+}
+
+// workflowJobConclusion returns the conclusion of a completed job, or the status otherwise
+func workflowJobConclusion(job *github.WorkflowJob) string {
+	if job.GetStatus() != jobStatusCompleted {
+		return job.GetStatus()
+	}
+	return job.GetConclusion()
+}
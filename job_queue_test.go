@@ -0,0 +1,125 @@
+package ghaprofiler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+func Test_ProfileJobQueues(t *testing.T) {
+	graph, err := parseWorkflowJobGraph([]byte(`
+jobs:
+  lint:
+    name: Lint
+    runs-on: ubuntu-latest
+  build:
+    runs-on: ${{ matrix.os }}
+  deploy:
+    needs: build
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	graphs := map[workflowJobGraphKey]*workflowJobGraph{
+		{repository: "owner/repo", revision: "aaaa1111"}: graph,
+	}
+	newRun := func(revision string, jobs ...*github.WorkflowJob) *WorkflowRunWithJobs {
+		return &WorkflowRunWithJobs{
+			Repository: "owner/repo",
+			Run: &github.WorkflowRun{
+				Status:    github.String("completed"),
+				CreatedAt: &github.Timestamp{Time: testBaseTime},
+			},
+			Jobs:     jobs,
+			Revision: revision,
+		}
+	}
+	newJob := func(name, conclusion string, startedAfter, elapsed time.Duration) *github.WorkflowJob {
+		job := newTestTimedJob(conclusion, startedAfter, elapsed)
+		job.Name = github.String(name)
+		return job
+	}
+	build1 := newJob("build (ubuntu-latest)", "success", 10*time.Second, 50*time.Second)
+	lint1 := newJob("Lint", "success", 5*time.Second, 10*time.Second)
+	// deploy needs build and waits 15 seconds after build completed
+	deploy1 := newJob("deploy", "success", 75*time.Second, 10*time.Second)
+	// build does not need lint, which completed before build started
+	build2 := newJob("build (ubuntu-latest)", "success", 30*time.Second, 50*time.Second)
+	lint2 := newJob("Lint", "failure", 5*time.Second, 10*time.Second)
+	deploy2 := newJob("deploy", "skipped", 0, 0)
+	// needs are unknown for an unknown revision
+	build3 := newJob("build (ubuntu-latest)", "success", 20*time.Second, 50*time.Second)
+	lint3 := newJob("Lint", "success", 7*time.Second, 10*time.Second)
+	runs := []*WorkflowRunWithJobs{
+		newRun("aaaa1111", build1, lint1, deploy1),
+		newRun("aaaa1111", build2, lint2, deploy2),
+		newRun("", build3, lint3),
+	}
+
+	jobsByJobName := NewJobsByJobNameMap()
+	jobsByJobName.Concat("build", []*github.WorkflowJob{build1, build2, build3})
+	jobsByJobName.Concat("lint", []*github.WorkflowJob{lint1, lint2, lint3})
+	jobsByJobName.Concat("deploy", []*github.WorkflowJob{deploy1, deploy2})
+
+	type expectedProfile struct {
+		name              string
+		executed, skipped int
+		min, max          float64
+	}
+	assertProfiles := func(title string, profiles TaskStepProfileResult, expected []expectedProfile) {
+		if len(profiles) != len(expected) {
+			t.Fatalf("%s: expected %d profiles, got %d", title, len(expected), len(profiles))
+		}
+		for i, e := range expected {
+			p := profiles[i]
+			if p.Number != int64(i+1) || p.Name != e.name {
+				t.Errorf("%s: expected #%d %s, got #%d %s", title, i+1, e.name, p.Number, p.Name)
+				continue
+			}
+			if p.Executed != e.executed || p.Skipped != e.skipped || p.Min != e.min || p.Max != e.max {
+				t.Errorf("%s: %s: unexpected stats: executed=%d, skipped=%d, min=%f, max=%f", title, p.Name, p.Executed, p.Skipped, p.Min, p.Max)
+			}
+		}
+	}
+
+	timings := estimateJobQueueTimings(runs, graphs)
+	queues, err := profileJobQueues(jobsByJobName, timings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertProfiles("queues", queues, []expectedProfile{
+		{name: "lint", executed: 2, skipped: 0, min: 5, max: 5},
+		{name: "build", executed: 2, skipped: 0, min: 10, max: 30},
+		{name: "deploy", executed: 1, skipped: 1, min: 15, max: 15},
+	})
+	if queues[1].Conclusions["success"] != 2 || queues[0].Conclusions["failure"] != 1 {
+		t.Errorf("unexpected conclusions: %v, %v", queues[0].Conclusions, queues[1].Conclusions)
+	}
+
+	startOffsets, err := profileJobStartOffsets(jobsByJobName, timings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertProfiles("start offsets", startOffsets, []expectedProfile{
+		{name: "lint", executed: 1, skipped: 0, min: 7, max: 7},
+		{name: "build", executed: 1, skipped: 0, min: 20, max: 20},
+		{name: "deploy", executed: 0, skipped: 1},
+	})
+
+	// every job is measured from the start of the workflow run without needs
+	startOffsets, err = profileJobStartOffsets(jobsByJobName, estimateJobQueueTimings(runs, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(startOffsets) != 3 || startOffsets[0].Executed != 3 {
+		t.Fatalf("unexpected start offsets: %+v", startOffsets)
+	}
+	queues, err = profileJobQueues(jobsByJobName, estimateJobQueueTimings(runs, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queues != nil {
+		t.Fatalf("expected no queues, got %+v", queues)
+	}
+}
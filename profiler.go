@@ -0,0 +1,1202 @@
+package ghaprofiler
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// LevelRun profiles time to the first job, wall-clock time and the sum of job durations of workflow runs
+	LevelRun = "run"
+	// LevelJob profiles durations of jobs
+	LevelJob = "job"
+	// LevelStep profiles durations of steps of each job
+	LevelStep = "step"
+)
+
+var availableLevels = []string{
+	LevelRun,
+	LevelJob,
+	LevelStep,
+}
+
+func IsValidLevel(level string) bool {
+	for _, available := range availableLevels {
+		if level == available {
+			return true
+		}
+	}
+	return false
+}
+
+// Profiler fetches workflow runs with their jobs and profiles their steps.
+// Create it with NewProfiler and options.
+type Profiler struct {
+	config   *ProfileConfig
+	client   *Client
+	limiter  ConcurrencyLimiter
+	database *Database
+	// workflowRuns are profiled instead of fetching when they are given
+	workflowRuns []*WorkflowRunWithJobs
+	logger       *log.Logger
+	// progress is nil unless progress is reported
+	progress *Progress
+	// ownsClient is true when the client is created by the profiler, which applies cache-max-size after fetching
+	ownsClient bool
+}
+
+// ProfilerOption configures a Profiler
+type ProfilerOption func(p *Profiler) error
+
+// ProfileResult is a result of Profiler.Run
+type ProfileResult struct {
+	// Workflows are profiles of each workflow
+	Workflows ProfileInput
+	// WorkflowRuns are the profiled workflow runs with their jobs
+	WorkflowRuns []*WorkflowRunWithJobs
+	// FetchedAt is when fetching workflow runs started
+	FetchedAt time.Time
+	// Partial is true when fetching is interrupted and only workflow runs fetched so far are profiled
+	Partial bool
+}
+
+// NewProfiler returns a profiler configured with DefaultProfileConfig() and opts, applied in order
+func NewProfiler(opts ...ProfilerOption) (*Profiler, error) {
+	p := &Profiler{config: DefaultProfileConfig()}
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// WithConfig replaces the whole configuration with a copy of config.
+// Pass it before other options so that they are not overwritten.
+func WithConfig(config *ProfileConfig) ProfilerOption {
+	return func(p *Profiler) error {
+		if config == nil {
+			return fmt.Errorf("Config must not be nil")
+		}
+		p.config = config.clone()
+		return nil
+	}
+}
+
+// WithClient makes the profiler use client instead of creating one from the configuration
+func WithClient(client *Client) ProfilerOption {
+	return func(p *Profiler) error {
+		p.client = client
+		return nil
+	}
+}
+
+// WithConcurrencyLimiter limits concurrent requests with limiter instead of concurrency in the configuration
+func WithConcurrencyLimiter(limiter ConcurrencyLimiter) ProfilerOption {
+	return func(p *Profiler) error {
+		p.limiter = limiter
+		return nil
+	}
+}
+
+// WithRepository profiles a repository
+func WithRepository(owner, name string) ProfilerOption {
+	return func(p *Profiler) error {
+		p.config.Owner = owner
+		p.config.Repository = name
+		return nil
+	}
+}
+
+// WithRepositories profiles several repositories in owner/name format
+func WithRepositories(repositories ...string) ProfilerOption {
+	return func(p *Profiler) error {
+		for _, repository := range repositories {
+			if _, err := ParseRepositoryName(repository); err != nil {
+				return err
+			}
+		}
+		p.config.Repositories = append(p.config.Repositories, repositories...)
+		return nil
+	}
+}
+
+// WithWorkflowFiles profiles workflow files, which may be glob patterns
+func WithWorkflowFiles(patterns ...string) ProfilerOption {
+	return func(p *Profiler) error {
+		p.config.WorkflowFiles = append(p.config.WorkflowFiles, patterns...)
+		return nil
+	}
+}
+
+// WithAllWorkflows profiles every workflow of repositories
+func WithAllWorkflows() ProfilerOption {
+	return func(p *Profiler) error {
+		p.config.AllWorkflows = true
+		return nil
+	}
+}
+
+// WithNumberOfRuns profiles the latest n workflow runs of each workflow
+func WithNumberOfRuns(n int) ProfilerOption {
+	return func(p *Profiler) error {
+		if n <= 0 {
+			return fmt.Errorf("NumberOfJob must be a positive integer")
+		}
+		p.config.NumberOfJob = n
+		return nil
+	}
+}
+
+// WithBranch profiles only workflow runs of the branch
+func WithBranch(branch string) ProfilerOption {
+	return func(p *Profiler) error {
+		p.config.Branch = branch
+		return nil
+	}
+}
+
+// WithEvent profiles only workflow runs triggered by the event
+func WithEvent(event string) ProfilerOption {
+	return func(p *Profiler) error {
+		p.config.Event = event
+		return nil
+	}
+}
+
+// WithStatus profiles only workflow runs with the status
+func WithStatus(status string) ProfilerOption {
+	return func(p *Profiler) error {
+		if !IsValidRunStatus(status) {
+			return fmt.Errorf("Invalid status: %s", status)
+		}
+		p.config.Status = status
+		return nil
+	}
+}
+
+// WithConclusion profiles only workflow runs with the conclusion
+func WithConclusion(conclusion string) ProfilerOption {
+	return func(p *Profiler) error {
+		if !IsValidRunConclusion(conclusion) {
+			return fmt.Errorf("Invalid conclusion: %s", conclusion)
+		}
+		p.config.Conclusion = conclusion
+		return nil
+	}
+}
+
+// WithActor profiles only workflow runs triggered by the user
+func WithActor(actor string) ProfilerOption {
+	return func(p *Profiler) error {
+		p.config.Actor = actor
+		return nil
+	}
+}
+
+// WithTimeRange profiles only workflow runs created between since and until.
+// A zero time means no bound.
+func WithTimeRange(since, until time.Time) ProfilerOption {
+	return func(p *Profiler) error {
+		if !since.IsZero() && !until.IsZero() && until.Before(since) {
+			return fmt.Errorf("until must not be before since")
+		}
+		p.config.Since = ""
+		if !since.IsZero() {
+			p.config.Since = since.Format(time.RFC3339)
+		}
+		p.config.Until = ""
+		if !until.IsZero() {
+			p.config.Until = until.Format(time.RFC3339)
+		}
+		return nil
+	}
+}
+
+// WithJobNameRegexp profiles only jobs whose name matches expr
+func WithJobNameRegexp(expr string) ProfilerOption {
+	return func(p *Profiler) error {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("Invalid regular expression: %v", err)
+		}
+		p.config.JobNameRegexp = expr
+		return nil
+	}
+}
+
+// WithReplaceRule appends a rule to replace job names matching expr with replace,
+// which aggregates jobs of a matrix into one
+func WithReplaceRule(expr, replace string) ProfilerOption {
+	return func(p *Profiler) error {
+		rule, err := NewReplaceRule(expr, replace)
+		if err != nil {
+			return err
+		}
+		p.config.Replace = append(p.config.Replace, *rule)
+		return nil
+	}
+}
+
+// WithSort sorts steps of each job by field, in reverse order if reverse is true
+func WithSort(field string, reverse bool) ProfilerOption {
+	return func(p *Profiler) error {
+		if !IsValidSortFieldName(field) {
+			return fmt.Errorf("Invalid sort field name: %s", field)
+		}
+		p.config.SortBy = field
+		p.config.Reverse = reverse
+		return nil
+	}
+}
+
+// WithLevels profiles only the levels of LevelRun, LevelJob and LevelStep instead of every level
+func WithLevels(levels ...string) ProfilerOption {
+	return func(p *Profiler) error {
+		for _, level := range levels {
+			if !IsValidLevel(level) {
+				return fmt.Errorf("Invalid level: %s", level)
+			}
+		}
+		p.config.Levels = append(p.config.Levels, levels...)
+		return nil
+	}
+}
+
+// WithStepKey identifies the same step among jobs by StepKeyNumber, StepKeyName or StepKeyAligned
+func WithStepKey(stepKey string) ProfilerOption {
+	return func(p *Profiler) error {
+		if !IsValidStepKey(stepKey) {
+			return fmt.Errorf("Invalid step key: %s", stepKey)
+		}
+		p.config.StepKey = stepKey
+		return nil
+	}
+}
+
+// WithGroupByRevision profiles workflow runs of each revision of the workflow file separately
+func WithGroupByRevision() ProfilerOption {
+	return func(p *Profiler) error {
+		p.config.GroupByRevision = true
+		return nil
+	}
+}
+
+// WithRevisions profiles only workflow runs of the revisions of the workflow file,
+// which are blob SHAs, their prefixes or RevisionLatest
+func WithRevisions(revisions ...string) ProfilerOption {
+	return func(p *Profiler) error {
+		for _, revision := range revisions {
+			if !IsValidRevision(revision) {
+				return fmt.Errorf("Invalid revision: %s", revision)
+			}
+		}
+		p.config.Revisions = append(p.config.Revisions, revisions...)
+		return nil
+	}
+}
+
+// WithIncludeSkippedSteps profiles steps which are skipped too
+func WithIncludeSkippedSteps() ProfilerOption {
+	return func(p *Profiler) error {
+		p.config.IncludeSkippedSteps = true
+		return nil
+	}
+}
+
+// WithAllAttempts profiles jobs of every attempt of workflow runs instead of the latest one
+func WithAllAttempts() ProfilerOption {
+	return func(p *Profiler) error {
+		p.config.AllAttempts = true
+		return nil
+	}
+}
+
+// WithInputs profiles workflow runs of recorded files or directories instead of fetching them
+func WithInputs(paths ...string) ProfilerOption {
+	return func(p *Profiler) error {
+		p.config.Inputs = append(p.config.Inputs, paths...)
+		return nil
+	}
+}
+
+// WithWorkflowRuns profiles workflow runs instead of fetching them.
+// Filters in the configuration except actor are still applied.
+func WithWorkflowRuns(workflowRuns []*WorkflowRunWithJobs) ProfilerOption {
+	return func(p *Profiler) error {
+		if workflowRuns == nil {
+			workflowRuns = []*WorkflowRunWithJobs{}
+		}
+		p.workflowRuns = workflowRuns
+		return nil
+	}
+}
+
+// WithDatabase profiles workflow runs stored in db instead of fetching them with Run, and stores them with Sync
+func WithDatabase(db *Database) ProfilerOption {
+	return func(p *Profiler) error {
+		p.database = db
+		return nil
+	}
+}
+
+// WithLogger writes progress and warnings to logger instead of the standard logger
+func WithLogger(logger *log.Logger) ProfilerOption {
+	return func(p *Profiler) error {
+		p.logger = logger
+		return nil
+	}
+}
+
+// WithProgress reports progress of fetching to progress.
+// Cache hits and the remaining rate limit are reported only with a client created by the profiler.
+// Pass progress.Writer() to log.SetOutput or WithLogger so that log messages do not break the status line.
+func WithProgress(progress *Progress) ProfilerOption {
+	return func(p *Profiler) error {
+		p.progress = progress
+		return nil
+	}
+}
+
+// WithVerbose enables verbose logging
+func WithVerbose(verbose bool) ProfilerOption {
+	return func(p *Profiler) error {
+		p.config.Verbose = verbose
+		return nil
+	}
+}
+
+// Run profiles workflow runs of the workflow runs given by WithWorkflowRuns, the database, input files
+// or GitHub in this order of precedence.
+// When ctx is done while fetching, it profiles workflow runs fetched so far and returns a result
+// marked as partial with no error. It returns the error of ctx when nothing is fetched.
+func (p *Profiler) Run(ctx context.Context) (*ProfileResult, error) {
+	if err := p.validate(p.database != nil); err != nil {
+		return nil, err
+	}
+	jobNameRegex, err := regexp.Compile(p.config.JobNameRegexp)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ProfileResult{FetchedAt: time.Now()}
+	var workflowRuns []*WorkflowRunWithJobs
+	switch {
+	case p.workflowRuns != nil:
+		workflowRuns, err = p.filterWorkflowRuns(p.workflowRuns)
+		if err == nil {
+			p.logf("Analyzing %d workflow runs", len(workflowRuns))
+		}
+	case p.database != nil:
+		workflowRuns, err = p.loadWorkflowRunsFromDatabase()
+	case p.config.IsOffline():
+		workflowRuns, err = p.loadWorkflowRuns()
+	default:
+		if err := p.prepareClient(ctx); err != nil {
+			return nil, err
+		}
+		p.progress.start()
+		workflowRuns, err = p.fetchWorkflowRuns(ctx)
+		p.progress.stop()
+		p.evictCacheBySize()
+	}
+	if err != nil {
+		if ctx.Err() == nil || len(workflowRuns) == 0 {
+			return nil, err
+		}
+		p.logf("%s; profiling %d workflow runs fetched so far", interruptionReason(ctx), len(workflowRuns))
+		result.Partial = true
+	}
+	if p.config.UsesRevisions() {
+		workflowRuns, err = p.applyRevisions(ctx, workflowRuns)
+		if err != nil {
+			if ctx.Err() == nil {
+				return nil, err
+			}
+			p.logf("%s; revisions of some workflow runs are unknown", interruptionReason(ctx))
+			result.Partial = true
+		}
+	}
+
+	var jobGraphs map[workflowJobGraphKey]*workflowJobGraph
+	if p.config.HasLevel(LevelJob) {
+		// needs of jobs tell when jobs were ready to wait for a runner
+		jobGraphs, err = p.loadWorkflowJobGraphs(ctx, workflowRuns)
+		if err != nil {
+			if ctx.Err() == nil {
+				return nil, err
+			}
+			p.logf("%s; needs of some jobs are unknown", interruptionReason(ctx))
+			result.Partial = true
+		}
+	}
+
+	workflows, err := p.profileWorkflowRuns(jobNameRegex, workflowRuns, jobGraphs)
+	if err != nil {
+		return nil, err
+	}
+	if result.Partial {
+		for _, workflow := range workflows {
+			workflow.Partial = true
+		}
+	}
+	result.Workflows = workflows
+	result.WorkflowRuns = workflowRuns
+	return result, nil
+}
+
+// Sync stores workflow runs created after the last sync to the database given by WithDatabase,
+// and updates ones which were in progress.
+// When ctx is done, workflow runs fetched so far are stored and the error of ctx is returned.
+func (p *Profiler) Sync(ctx context.Context) error {
+	if p.database == nil {
+		return fmt.Errorf("Database required to sync")
+	}
+	if err := p.validate(false); err != nil {
+		return err
+	}
+	if err := p.prepareClient(ctx); err != nil {
+		return err
+	}
+	defer p.evictCacheBySize()
+	p.progress.start()
+	defer p.progress.stop()
+	return p.forEachWorkflow(ctx, func(repository *RepositoryName, workflowFileName string) error {
+		return p.syncWorkflow(ctx, repository, workflowFileName)
+	})
+}
+
+// validate validates the config, where offline is whether workflow runs are loaded from the database
+func (p *Profiler) validate(offline bool) error {
+	return p.config.validate(offline || p.config.IsOffline() || p.workflowRuns != nil)
+}
+
+// prepareClient creates a client and a limiter from the configuration unless they are given
+func (p *Profiler) prepareClient(ctx context.Context) error {
+	if p.client == nil {
+		client, limiter, err := p.newClient(ctx)
+		if err != nil {
+			return err
+		}
+		p.client = client
+		p.ownsClient = true
+		if p.limiter == nil {
+			p.limiter = limiter
+		}
+	}
+	if p.limiter == nil {
+		p.limiter = NewFixedConcurrencyLimiter(p.config.Concurrency)
+	}
+	return nil
+}
+
+// evictCacheBySize applies cache-max-size after fetching with a client created by the profiler
+func (p *Profiler) evictCacheBySize() {
+	if !p.ownsClient || !p.config.Cache || p.config.CacheMaxSize == "" {
+		return
+	}
+	maxSize, err := ParseByteSize(p.config.CacheMaxSize)
+	if err != nil {
+		p.logf("%v", err)
+		return
+	}
+	removed, err := EvictCache(p.config.CacheDirectory, maxSize)
+	if len(removed) > 0 {
+		p.logfVerbose("Evicted %d cache entries to keep the cache within %s", len(removed), p.config.CacheMaxSize)
+	}
+	if err != nil {
+		p.logf("Failed to evict cache: %v", err)
+	}
+}
+
+func (p *Profiler) logf(format string, args ...interface{}) {
+	if p.logger != nil {
+		p.logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+func (p *Profiler) loglnVerbose(s interface{}) {
+	if !p.config.Verbose {
+		return
+	}
+	p.logf("%v", s)
+}
+
+func (p *Profiler) logfVerbose(format string, args ...interface{}) {
+	if !p.config.Verbose {
+		return
+	}
+	p.logf(format, args...)
+}
+
+// fetchWorkflowRuns fetches workflow runs with their jobs from GitHub.
+// When ctx is done, it returns the error of ctx and workflow runs fetched so far.
+func (p *Profiler) fetchWorkflowRuns(ctx context.Context) ([]*WorkflowRunWithJobs, error) {
+	var workflowRuns []*WorkflowRunWithJobs
+	err := p.forEachWorkflow(ctx, func(repository *RepositoryName, workflowFileName string) error {
+		runs, err := p.collectWorkflowRuns(ctx, repository, workflowFileName)
+		// runs fetched before an interruption are kept
+		workflowRuns = append(workflowRuns, compactWorkflowRuns(runs)...)
+		return err
+	})
+	return workflowRuns, err
+}
+
+// interruptionReason describes why ctx is done
+func interruptionReason(ctx context.Context) string {
+	if ctx.Err() == context.DeadlineExceeded {
+		return "Timed out"
+	}
+	return "Interrupted"
+}
+
+// newClient returns a client for GitHub and a limiter to share its concurrency
+func (p *Profiler) newClient(ctx context.Context) (*Client, ConcurrencyLimiter, error) {
+	clientConfig := &ClientConfig{
+		AccessToken:    p.config.AccessToken,
+		BaseURL:        p.config.BaseURL,
+		UploadURL:      p.config.UploadURL,
+		Cache:          p.config.Cache,
+		CacheDirectory: p.config.CacheDirectory,
+		MaxRetries:     p.config.MaxRetries,
+		Verbose:        p.config.Verbose,
+		Logger:         p.logger,
+	}
+	if p.config.AppID != 0 {
+		privateKey, err := ioutil.ReadFile(p.config.AppPrivateKeyPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		clientConfig.AppID = p.config.AppID
+		clientConfig.AppInstallationID = p.config.AppInstallationID
+		clientConfig.AppPrivateKey = privateKey
+		p.loglnVerbose("Authenticate as a GitHub App installation")
+	} else if p.config.AccessToken == "" {
+		host, err := clientConfig.WebHost()
+		if err != nil {
+			return nil, nil, err
+		}
+		// the token itself must never be logged
+		token, source := DiscoverAccessToken(ctx, host)
+		if token != "" {
+			p.logfVerbose("Use an access token for %s from %s", host, source)
+			clientConfig.AccessToken = token
+		} else {
+			p.logfVerbose("No access token found for %s", host)
+		}
+	} else {
+		p.loglnVerbose("Use the access token from the configuration")
+	}
+	var limiter ConcurrencyLimiter
+	var observers ResponseObservers
+	if p.config.AdaptiveConcurrency {
+		adaptiveLimiter := NewAdaptiveConcurrencyLimiter(p.config.Concurrency, p.config.MaxConcurrency, p.config.Verbose)
+		observers = append(observers, adaptiveLimiter)
+		limiter = adaptiveLimiter
+	} else {
+		limiter = NewFixedConcurrencyLimiter(p.config.Concurrency)
+	}
+	if p.progress != nil {
+		observers = append(observers, p.progress)
+		clientConfig.CacheObserver = p.progress
+	}
+	if len(observers) > 0 {
+		clientConfig.ResponseObserver = observers
+	}
+	client, err := NewClientWithConfig(ctx, clientConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, limiter, nil
+}
+
+// forEachWorkflow calls fn with every workflow file of every repository to profile.
+// Repositories and workflows which are not found are skipped when profiling several repositories.
+func (p *Profiler) forEachWorkflow(ctx context.Context, fn func(repository *RepositoryName, workflowFileName string) error) error {
+	repositories, err := p.resolveRepositories(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, repository := range repositories {
+		workflowFileNames, err := p.resolveWorkflowFileNames(ctx, repository)
+		if err != nil {
+			if p.config.IsMultiRepository() {
+				p.logf("Skipping %s: %v", repository, err)
+				continue
+			}
+			return err
+		}
+		p.logfVerbose("workflow files of %s: %v", repository, workflowFileNames)
+
+		for _, workflowFileName := range workflowFileNames {
+			if err := fn(repository, workflowFileName); err != nil {
+				if p.config.IsMultiRepository() && isNotFoundError(err) {
+					p.logf("Skipping %s of %s: workflow not found", workflowFileName, repository)
+					continue
+				}
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loadWorkflowRuns loads workflow runs with their jobs from input files, and filters them
+func (p *Profiler) loadWorkflowRuns() ([]*WorkflowRunWithJobs, error) {
+	var defaultRepository string
+	if p.config.Owner != "" && p.config.Repository != "" {
+		defaultRepository = RepositoryName{Owner: p.config.Owner, Name: p.config.Repository}.String()
+	}
+	patterns := p.config.WorkflowFilePatterns()
+	var defaultWorkflowFileName string
+	if len(patterns) == 1 && !isGlobPattern(patterns[0]) {
+		defaultWorkflowFileName = patterns[0]
+	}
+	if p.config.Actor != "" {
+		p.logf("actor is ignored for input files")
+	}
+
+	var loadedRuns []*WorkflowRunWithJobs
+	for _, input := range p.config.Inputs {
+		runs, err := LoadWorkflowRunsFromFile(input, defaultRepository, defaultWorkflowFileName)
+		if err != nil {
+			return nil, err
+		}
+		p.logfVerbose("Loaded %d workflow runs from %s", len(runs), input)
+		loadedRuns = append(loadedRuns, runs...)
+	}
+	workflowRuns, err := p.filterWorkflowRuns(loadedRuns)
+	if err != nil {
+		return nil, err
+	}
+	p.logf("Analyzing %d workflow runs", len(workflowRuns))
+	return workflowRuns, nil
+}
+
+// filterWorkflowRuns filters workflow runs which are not fetched from GitHub by workflow file patterns
+// and filters of workflow runs except actor
+func (p *Profiler) filterWorkflowRuns(runs []*WorkflowRunWithJobs) ([]*WorkflowRunWithJobs, error) {
+	patterns := p.config.WorkflowFilePatterns()
+	workflowRunFilter, err := p.config.WorkflowRunFilter(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var workflowRuns []*WorkflowRunWithJobs
+	for _, run := range runs {
+		if !matchWorkflowFilePatterns(patterns, run.WorkflowFileName) {
+			continue
+		}
+		if !workflowRunFilter.Match(run.Run) {
+			continue
+		}
+		workflowRuns = append(workflowRuns, run)
+	}
+	return workflowRuns, nil
+}
+
+// matchWorkflowFilePatterns reports whether workflowFileName matches any of patterns.
+// It always returns true if there are no patterns.
+func matchWorkflowFilePatterns(patterns []string, workflowFileName string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, workflowFileName); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// profileWorkflowRuns profiles runs of each workflow of each repository, and of each revision with group-by-revision.
+// When a workflow file is found in several repositories, a profile aggregated across them is appended.
+func (p *Profiler) profileWorkflowRuns(jobNameRegex *regexp.Regexp, workflowRuns []*WorkflowRunWithJobs, jobGraphs map[workflowJobGraphKey]*workflowJobGraph) (ProfileInput, error) {
+	var profileFormatterInput ProfileInput
+
+	type workflowKey struct {
+		repository       string
+		workflowFileName string
+		// revision is empty unless grouped by revision
+		revision string
+	}
+	var workflowKeys []workflowKey
+	runsByWorkflow := make(map[workflowKey][]*WorkflowRunWithJobs)
+	for _, run := range workflowRuns {
+		key := workflowKey{repository: run.Repository, workflowFileName: run.WorkflowFileName}
+		if p.config.GroupByRevision {
+			key.revision = run.Revision
+			if key.revision == "" {
+				key.revision = revisionUnknown
+			}
+		}
+		if _, ok := runsByWorkflow[key]; !ok {
+			workflowKeys = append(workflowKeys, key)
+		}
+		runsByWorkflow[key] = append(runsByWorkflow[key], run)
+	}
+	if p.config.GroupByRevision {
+		// revisions of the same workflow are next to each other from the newest one
+		workflowOrder := make(map[workflowKey]int)
+		for _, key := range workflowKeys {
+			withoutRevision := workflowKey{repository: key.repository, workflowFileName: key.workflowFileName}
+			if _, ok := workflowOrder[withoutRevision]; !ok {
+				workflowOrder[withoutRevision] = len(workflowOrder)
+			}
+		}
+		sort.SliceStable(workflowKeys, func(i, j int) bool {
+			oi := workflowOrder[workflowKey{repository: workflowKeys[i].repository, workflowFileName: workflowKeys[i].workflowFileName}]
+			oj := workflowOrder[workflowKey{repository: workflowKeys[j].repository, workflowFileName: workflowKeys[j].workflowFileName}]
+			if oi != oj {
+				return oi < oj
+			}
+			return latestCreatedAt(runsByWorkflow[workflowKeys[i]]).After(latestCreatedAt(runsByWorkflow[workflowKeys[j]]))
+		})
+	}
+
+	// jobs of the same workflow file (and the same revision) across repositories, which are aggregated by step name
+	type aggregateKey struct {
+		workflowFileName string
+		revision         string
+	}
+	jobsByAggregateKey := make(map[aggregateKey]*jobsByJobNameMap)
+	runsByAggregateKey := make(map[aggregateKey][]*WorkflowRunWithJobs)
+	repositoriesByAggregateKey := make(map[aggregateKey][]string)
+	queueTimings := estimateJobQueueTimings(workflowRuns, jobGraphs)
+	for _, key := range workflowKeys {
+		runProfiles, err := p.profileRuns(runsByWorkflow[key])
+		if err != nil {
+			return nil, err
+		}
+		jobsByJobName := p.groupJobsByJobName(jobNameRegex, runsByWorkflow[key])
+		jobProfiles, err := profileJobs(p.config, jobsByJobName, p.config.StepKey)
+		if err != nil {
+			return nil, err
+		}
+		p.reportStepIdentityChanges(key.repository, key.workflowFileName, jobProfiles)
+		jobQueues, jobStartOffsets, err := p.profileJobQueues(jobsByJobName, queueTimings)
+		if err != nil {
+			return nil, err
+		}
+		profileFormatterInput = append(profileFormatterInput, &WorkflowProfileForFormatter{
+			Repository:      key.repository,
+			Name:            key.workflowFileName,
+			Revision:        key.revision,
+			Runs:            runProfiles,
+			JobQueues:       jobQueues,
+			JobStartOffsets: jobStartOffsets,
+			Jobs:            jobProfiles,
+		})
+
+		aggregated := aggregateKey{workflowFileName: key.workflowFileName, revision: key.revision}
+		runsByAggregateKey[aggregated] = append(runsByAggregateKey[aggregated], runsByWorkflow[key]...)
+		if _, ok := jobsByAggregateKey[aggregated]; !ok {
+			jobsByAggregateKey[aggregated] = NewJobsByJobNameMap()
+		}
+		for jobName, jobs := range jobsByJobName.Iterate() {
+			jobsByAggregateKey[aggregated].Concat(jobName, jobs)
+		}
+		repositoriesByAggregateKey[aggregated] = append(repositoriesByAggregateKey[aggregated], key.repository)
+	}
+
+	var aggregateKeys []aggregateKey
+	for key := range jobsByAggregateKey {
+		aggregateKeys = append(aggregateKeys, key)
+	}
+	sort.Slice(aggregateKeys, func(i, j int) bool {
+		if aggregateKeys[i].workflowFileName != aggregateKeys[j].workflowFileName {
+			return aggregateKeys[i].workflowFileName < aggregateKeys[j].workflowFileName
+		}
+		ti, tj := latestCreatedAt(runsByAggregateKey[aggregateKeys[i]]), latestCreatedAt(runsByAggregateKey[aggregateKeys[j]])
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return aggregateKeys[i].revision < aggregateKeys[j].revision
+	})
+	for _, key := range aggregateKeys {
+		if len(repositoriesByAggregateKey[key]) <= 1 {
+			continue
+		}
+		runProfiles, err := p.profileRuns(runsByAggregateKey[key])
+		if err != nil {
+			return nil, err
+		}
+		// step numbers differ among repositories, so identify steps by name unless they are aligned
+		stepKey := StepKeyName
+		if p.config.StepKey == StepKeyAligned {
+			stepKey = StepKeyAligned
+		}
+		jobProfiles, err := profileJobs(p.config, jobsByAggregateKey[key], stepKey)
+		if err != nil {
+			return nil, err
+		}
+		jobQueues, jobStartOffsets, err := p.profileJobQueues(jobsByAggregateKey[key], queueTimings)
+		if err != nil {
+			return nil, err
+		}
+		profileFormatterInput = append(profileFormatterInput, &WorkflowProfileForFormatter{
+			Repositories:    repositoriesByAggregateKey[key],
+			Name:            key.workflowFileName,
+			Revision:        key.revision,
+			Runs:            runProfiles,
+			JobQueues:       jobQueues,
+			JobStartOffsets: jobStartOffsets,
+			Jobs:            jobProfiles,
+		})
+	}
+	return profileFormatterInput, nil
+}
+
+// latestCreatedAt returns when the newest workflow run was created
+func latestCreatedAt(workflowRuns []*WorkflowRunWithJobs) time.Time {
+	var latest time.Time
+	for _, run := range workflowRuns {
+		if createdAt := run.Run.GetCreatedAt().Time; createdAt.After(latest) {
+			latest = createdAt
+		}
+	}
+	return latest
+}
+
+// reportStepIdentityChanges logs steps which had several names or several numbers over the sampled workflow runs,
+// which means steps were added to or removed from the workflow
+func (p *Profiler) reportStepIdentityChanges(repository, workflowFileName string, jobProfiles []*ProfileForFormatter) {
+	for _, job := range jobProfiles {
+		for _, step := range job.Profile {
+			if len(step.Names) > 1 {
+				p.logf("Steps numbered %d of job %s in %s (%s) have several names: %s. Pass --step-key aligned to identify steps by name", step.Number, job.Name, workflowFileName, repository, strings.Join(step.Names, ", "))
+			} else if len(step.Numbers) > 1 {
+				p.logfVerbose("Step %s of job %s in %s (%s) has several numbers: %v", step.Name, job.Name, workflowFileName, repository, step.Numbers)
+			}
+		}
+	}
+}
+
+// profileRuns profiles workflow runs with every job of them regardless of job-name-regexp,
+// or returns nil unless the run level is output
+func (p *Profiler) profileRuns(workflowRuns []*WorkflowRunWithJobs) ([]*RunMetricProfile, error) {
+	if !p.config.HasLevel(LevelRun) {
+		return nil, nil
+	}
+	return ProfileWorkflowRunTimes(workflowRuns)
+}
+
+// groupJobsByJobName filters jobs by job-name-regexp and groups them by job name after replace rules
+func (p *Profiler) groupJobsByJobName(jobNameRegex *regexp.Regexp, workflowRuns []*WorkflowRunWithJobs) *jobsByJobNameMap {
+	jobsByJobName := NewJobsByJobNameMap()
+	for _, run := range workflowRuns {
+		for _, job := range run.Jobs {
+			jobName := job.GetName()
+			if !jobNameRegex.MatchString(jobName) {
+				continue
+			}
+			p.logfVerbose("Job name (before replacement): %#v", jobName)
+			for _, rule := range p.config.Replace {
+				jobName = rule.Apply(jobName)
+			}
+			p.logfVerbose("Job name (after replacement): %#v", jobName)
+			jobsByJobName.Append(jobName, job)
+		}
+	}
+	return jobsByJobName
+}
+
+// resolveRepositories returns repositories to profile
+func (p *Profiler) resolveRepositories(ctx context.Context) ([]*RepositoryName, error) {
+	if !p.config.IsMultiRepository() {
+		return []*RepositoryName{{Owner: p.config.Owner, Name: p.config.Repository}}, nil
+	}
+
+	var repositories []*RepositoryName
+	seen := make(map[string]bool)
+	for _, s := range p.config.Repositories {
+		repository, err := ParseRepositoryName(s)
+		if err != nil {
+			return nil, err
+		}
+		if seen[repository.String()] {
+			continue
+		}
+		seen[repository.String()] = true
+		repositories = append(repositories, repository)
+	}
+
+	if p.config.DiscoverOwner != "" {
+		p.logfVerbose("ListRepositories start: owner=%s", p.config.DiscoverOwner)
+		discovered, err := p.client.ListAllRepositoriesByOwner(ctx, p.config.DiscoverOwner)
+		if err != nil {
+			return nil, err
+		}
+		p.logfVerbose("ListRepositories finish: owner=%s, repositories=%d", p.config.DiscoverOwner, len(discovered))
+		for _, repo := range discovered {
+			if repo.GetArchived() {
+				continue
+			}
+			repository := &RepositoryName{Owner: repo.GetOwner().GetLogin(), Name: repo.GetName()}
+			if seen[repository.String()] {
+				continue
+			}
+			seen[repository.String()] = true
+			repositories = append(repositories, repository)
+		}
+	}
+
+	if len(repositories) == 0 {
+		return nil, fmt.Errorf("No repository to profile")
+	}
+	return repositories, nil
+}
+
+// resolveWorkflowFileNames expands glob patterns and all-workflows option into workflow file names
+func (p *Profiler) resolveWorkflowFileNames(ctx context.Context, repository *RepositoryName) ([]string, error) {
+	patterns := p.config.WorkflowFilePatterns()
+	needsListWorkflows := p.config.AllWorkflows
+	for _, pattern := range patterns {
+		if isGlobPattern(pattern) {
+			needsListWorkflows = true
+		}
+	}
+	if !needsListWorkflows {
+		return patterns, nil
+	}
+
+	p.loglnVerbose("ListWorkflows start")
+	workflows, err := p.client.ListAllWorkflows(ctx, repository.Owner, repository.Name)
+	if err != nil {
+		return nil, err
+	}
+	p.loglnVerbose("ListWorkflows finish")
+
+	var workflowFileNames []string
+	seen := make(map[string]bool)
+	appendWorkflowFileName := func(workflowFileName string) {
+		if seen[workflowFileName] {
+			return
+		}
+		seen[workflowFileName] = true
+		workflowFileNames = append(workflowFileNames, workflowFileName)
+	}
+	for _, pattern := range patterns {
+		if !isGlobPattern(pattern) {
+			appendWorkflowFileName(pattern)
+			continue
+		}
+		for _, workflow := range workflows {
+			workflowFileName := path.Base(workflow.GetPath())
+			if matched, _ := path.Match(pattern, workflowFileName); matched {
+				appendWorkflowFileName(workflowFileName)
+			}
+		}
+	}
+	if p.config.AllWorkflows {
+		for _, workflow := range workflows {
+			appendWorkflowFileName(path.Base(workflow.GetPath()))
+		}
+	}
+	if len(workflowFileNames) == 0 {
+		return nil, fmt.Errorf("No workflow matches %v", patterns)
+	}
+	sort.Strings(workflowFileNames)
+	return workflowFileNames, nil
+}
+
+// collectWorkflowRuns fetches the latest workflow runs with their jobs
+func (p *Profiler) collectWorkflowRuns(ctx context.Context, repository *RepositoryName, workflowFileName string) ([]*WorkflowRunWithJobs, error) {
+	workflowRunFilter, err := p.config.WorkflowRunFilter(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	p.logfVerbose("ListWorkflowRunsByFileName start: repository=%s, workflow=%s", repository, workflowFileName)
+	workflowRuns, err := p.client.ListWorkflowRunsByFileNameWithLimit(ctx, repository.Owner, repository.Name, workflowFileName, p.config.ListWorkflowRunsOptions(), workflowRunFilter, p.config.NumberOfJob)
+	if err != nil {
+		return nil, err
+	}
+	p.logfVerbose("ListWorkflowRunsByFileName finish: repository=%s, workflow=%s", repository, workflowFileName)
+	p.progress.addListedRuns(len(workflowRuns))
+	if len(workflowRuns) < p.config.NumberOfJob {
+		p.logf("Only %d of %d workflow runs are available for %s of %s", len(workflowRuns), p.config.NumberOfJob, workflowFileName, repository)
+	}
+	p.logf("Analyzing %d workflow runs of %s of %s", len(workflowRuns), workflowFileName, repository)
+
+	return p.collectWorkflowJobs(ctx, repository, workflowFileName, workflowRuns)
+}
+
+// collectWorkflowJobs fetches jobs of each workflow run concurrently.
+// When ctx is done, it returns the error of ctx and the result so far, where workflow runs
+// whose jobs are not fetched are nil.
+func (p *Profiler) collectWorkflowJobs(ctx context.Context, repository *RepositoryName, workflowFileName string, workflowRuns []*WorkflowRun) ([]*WorkflowRunWithJobs, error) {
+	result := make([]*WorkflowRunWithJobs, len(workflowRuns))
+	p.progress.addJobsToFetch(len(workflowRuns))
+	// an error of a goroutine cancels the others
+	eg, egCtx := errgroup.WithContext(ctx)
+
+	var acquireErr error
+	for i, run := range workflowRuns {
+		i, run := i, run
+		if acquireErr = p.limiter.Acquire(egCtx); acquireErr != nil {
+			break
+		}
+		eg.Go(func() error {
+			defer p.limiter.Release()
+			p.logfVerbose("ListWorkflowJobs start: run_id=%d", run.GetID())
+			jobs, err := p.client.ListAllWorkflowJobsOfRun(egCtx, repository.Owner, repository.Name, run.WorkflowRun, p.config.AllAttempts)
+			if err != nil {
+				return err
+			}
+			p.logfVerbose("ListWorkflowJobs finish: run_id=%d, jobs=%d", run.GetID(), len(jobs))
+			p.progress.jobsFetched()
+
+			result[i] = &WorkflowRunWithJobs{
+				Repository:         repository.String(),
+				WorkflowFileName:   workflowFileName,
+				Run:                run.WorkflowRun,
+				Jobs:               jobs,
+				WorkflowRunAttempt: run.WorkflowRunAttempt,
+			}
+			return nil
+		})
+	}
+
+	err := eg.Wait()
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if acquireErr != nil {
+		return nil, acquireErr
+	}
+	return result, nil
+}
+
+// compactWorkflowRuns removes workflow runs whose jobs are not fetched
+func compactWorkflowRuns(workflowRuns []*WorkflowRunWithJobs) []*WorkflowRunWithJobs {
+	compacted := make([]*WorkflowRunWithJobs, 0, len(workflowRuns))
+	for _, run := range workflowRuns {
+		if run != nil {
+			compacted = append(compacted, run)
+		}
+	}
+	return compacted
+}
+
+// profileJobQueues profiles queue times of jobs whose needs are known and start times of the other jobs
+// sorted in the same way as steps, or returns nil unless the job level is output
+func (p *Profiler) profileJobQueues(jobsByJobName *jobsByJobNameMap, timings map[*github.WorkflowJob]*jobQueueTiming) (queues, startOffsets TaskStepProfileResult, err error) {
+	if !p.config.HasLevel(LevelJob) {
+		return nil, nil, nil
+	}
+	queues, err = profileJobQueues(jobsByJobName, timings)
+	if err != nil {
+		return nil, nil, err
+	}
+	if queues, err = sortProfile(p.config, queues); err != nil {
+		return nil, nil, err
+	}
+	startOffsets, err = profileJobStartOffsets(jobsByJobName, timings)
+	if err != nil {
+		return nil, nil, err
+	}
+	if startOffsets, err = sortProfile(p.config, startOffsets); err != nil {
+		return nil, nil, err
+	}
+	return queues, startOffsets, nil
+}
+
+// profileJobs profiles jobs and their steps of the job and step levels to output
+func profileJobs(config *ProfileConfig, jobsByJobName *jobsByJobNameMap, stepKey string) ([]*ProfileForFormatter, error) {
+	if !config.HasLevel(LevelJob) && !config.HasLevel(LevelStep) {
+		return nil, nil
+	}
+	profileResult := make(map[string][]*TaskStepProfile)
+	durationResult := make(map[string]*JobDurationProfile)
+	var formatterInputJobNames []string
+
+	for jobName, jobs := range jobsByJobName.Iterate() {
+		if len(jobs) == 0 {
+			continue
+		}
+		formatterInputJobNames = append(formatterInputJobNames, jobName)
+
+		if config.HasLevel(LevelJob) {
+			durationProfile, err := ProfileJobDuration(jobs, &ProfileJobDurationOptions{
+				IncludeAllJobs: config.IncludeSkippedSteps,
+			})
+			if err != nil {
+				return nil, err
+			}
+			durationResult[jobName] = durationProfile
+		}
+		if !config.HasLevel(LevelStep) {
+			continue
+		}
+
+		stepsOfJobs := make([][]*github.TaskStep, 0, len(jobs))
+		for _, job := range jobs {
+			stepsOfJobs = append(stepsOfJobs, job.Steps)
+		}
+
+		stepProfile, err := ProfileTaskStepsOfJobs(stepsOfJobs, &ProfileTaskStepOptions{
+			IncludeAllSteps: config.IncludeSkippedSteps,
+			StepKey:         stepKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if stepProfile == nil {
+			// a job without steps is still output at the step level
+			stepProfile = TaskStepProfileResult{}
+		}
+		profileResult[jobName], err = sortProfile(config, stepProfile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(formatterInputJobNames)
+
+	var jobProfiles []*ProfileForFormatter
+	for _, jobName := range formatterInputJobNames {
+		jobProfiles = append(jobProfiles, &ProfileForFormatter{
+			Name:     jobName,
+			Duration: durationResult[jobName],
+			Profile:  profileResult[jobName],
+		})
+	}
+	return jobProfiles, nil
+}
+
+// sortProfile sorts profile by sort and reverse options
+func sortProfile(config *ProfileConfig, profile TaskStepProfileResult) (TaskStepProfileResult, error) {
+	if err := SortProfileBy(profile, config.SortBy); err != nil {
+		return nil, err
+	}
+
+	// reverse slice
+	if config.Reverse {
+		reversedProfile := make(TaskStepProfileResult, len(profile))
+		for i := 0; i < len(profile); i++ {
+			j := len(profile) - i - 1
+			reversedProfile[i] = profile[j]
+		}
+		return reversedProfile, nil
+	}
+	return profile, nil
+}
+
+func isGlobPattern(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
@@ -0,0 +1,179 @@
+package ghaprofiler
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// syncWorkflow stores workflow runs of the workflow created after the last sync, and updates ones which were in progress
+func (p *Profiler) syncWorkflow(ctx context.Context, repository *RepositoryName, workflowFileName string) error {
+	pendingIDs, err := p.database.PendingWorkflowRunIDs(repository.String(), workflowFileName)
+	if err != nil {
+		return err
+	}
+	var pendingRuns []*WorkflowRun
+	for _, runID := range pendingIDs {
+		run, _, err := p.client.GetWorkflowRunByID(ctx, repository.Owner, repository.Name, runID)
+		if err != nil {
+			if isNotFoundError(err) {
+				// the workflow run was deleted; keep what is stored
+				p.logfVerbose("Pending workflow run %d of %s of %s is not found", runID, workflowFileName, repository)
+				continue
+			}
+			return err
+		}
+		pendingRuns = append(pendingRuns, run)
+	}
+
+	workflowRunFilter, err := p.config.WorkflowRunFilter(time.Now())
+	if err != nil {
+		return err
+	}
+	cursor, err := p.database.SyncCursor(repository.String(), workflowFileName)
+	if err != nil {
+		return err
+	}
+	isKnown := func(run *github.WorkflowRun) (bool, error) {
+		return p.database.HasWorkflowRun(repository.String(), workflowFileName, run.GetID())
+	}
+	var newRuns []*WorkflowRun
+	var newCursor *SyncCursor
+	if cursor.covers(p.config.syncFilter(), workflowRunFilter.Since) {
+		// every workflow run since the last sync is listed, or the history has a gap which no later sync fills
+		newRuns, err = p.client.ListNewWorkflowRunsByFileName(ctx, repository.Owner, repository.Name, workflowFileName, p.config.ListWorkflowRunsOptions(), workflowRunFilter, 0, isKnown)
+	} else {
+		// the last sync skipped workflow runs which this sync selects, so they are listed as on the first sync
+		newRuns, newCursor, err = p.listUnknownWorkflowRuns(ctx, repository, workflowFileName, workflowRunFilter, isKnown)
+	}
+	if err != nil {
+		return err
+	}
+	p.progress.addListedRuns(len(newRuns))
+
+	// listing stops at the newest stored run on the next sync, so new runs are fetched from oldest to newest
+	// to store them without a gap between them and the runs of the last sync even if interrupted
+	runsToFetch := make([]*WorkflowRun, 0, len(newRuns)+len(pendingRuns))
+	for i := len(newRuns) - 1; i >= 0; i-- {
+		runsToFetch = append(runsToFetch, newRuns[i])
+	}
+	runsToFetch = append(runsToFetch, pendingRuns...)
+	runs, err := p.collectWorkflowJobs(ctx, repository, workflowFileName, runsToFetch)
+	if err != nil && ctx.Err() == nil {
+		return err
+	}
+	newResult, pendingResult := runs[:len(newRuns)], compactWorkflowRuns(runs[len(newRuns):])
+	for i, run := range newResult {
+		if run == nil {
+			newResult = newResult[:i]
+			break
+		}
+	}
+	runsToStore := append(newResult, pendingResult...)
+	// revisions are always stored so that profiling the database with revisions does not need to resolve them
+	if revisionErr := p.resolveWorkflowRevisions(ctx, runsToStore); revisionErr != nil && ctx.Err() == nil {
+		p.logf("%v; revisions are resolved again when profiling with revisions", revisionErr)
+	}
+	if putErr := p.database.PutWorkflowRuns(runsToStore); putErr != nil {
+		return putErr
+	}
+	p.logf("Synced %d new and %d pending workflow runs of %s of %s", len(newResult), len(pendingResult), workflowFileName, repository)
+	if err != nil || newCursor == nil {
+		return err
+	}
+	// the cursor is stored only when every listed workflow run is stored, or the next sync lists them again
+	return p.database.PutSyncCursor(repository.String(), workflowFileName, newCursor)
+}
+
+// listUnknownWorkflowRuns lists workflow runs which are not stored, in the window given by since
+// or up to number-of-job workflow runs like profiling, with the cursor which the listing covers
+func (p *Profiler) listUnknownWorkflowRuns(ctx context.Context, repository *RepositoryName, workflowFileName string, workflowRunFilter *WorkflowRunFilter, isKnown func(*github.WorkflowRun) (bool, error)) ([]*WorkflowRun, *SyncCursor, error) {
+	limit := 0
+	if workflowRunFilter.Since.IsZero() {
+		limit = p.config.NumberOfJob
+	}
+	runs, err := p.client.ListWorkflowRunsByFileNameWithLimit(ctx, repository.Owner, repository.Name, workflowFileName, p.config.ListWorkflowRunsOptions(), workflowRunFilter, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	cursor := &SyncCursor{Filter: p.config.syncFilter(), Since: workflowRunFilter.Since}
+	if limit > 0 && len(runs) >= limit {
+		// older workflow runs may remain
+		cursor.Since = runs[len(runs)-1].GetCreatedAt().Time
+	}
+
+	var unknownRuns []*WorkflowRun
+	for _, run := range runs {
+		known, err := isKnown(run.WorkflowRun)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !known {
+			unknownRuns = append(unknownRuns, run)
+		}
+	}
+	return unknownRuns, cursor, nil
+}
+
+// loadWorkflowRunsFromDatabase loads stored workflow runs with their jobs, and filters them
+// in the same way as fetching from GitHub
+func (p *Profiler) loadWorkflowRunsFromDatabase() ([]*WorkflowRunWithJobs, error) {
+	if p.config.Actor != "" {
+		p.logf("actor is ignored for the database")
+	}
+	workflowRunFilter, err := p.config.WorkflowRunFilter(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	patterns := p.config.WorkflowFilePatterns()
+	storedRuns, err := p.database.LoadWorkflowRuns(func(repository, workflowFileName string) bool {
+		if !p.matchRepository(repository) {
+			return false
+		}
+		return p.config.AllWorkflows || matchWorkflowFilePatterns(patterns, workflowFileName)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// stored runs of each workflow are sorted from newest to oldest.
+	// A window given by since or until is profiled as a whole, and number-of-job limits runs otherwise.
+	limited := p.config.Since == "" && p.config.Until == ""
+	var workflowRuns []*WorkflowRunWithJobs
+	numberOfRuns := make(map[string]int)
+	for _, run := range storedRuns {
+		if !workflowRunFilter.Match(run.Run) {
+			continue
+		}
+		key := string(workflowBucketKey(run.Repository, run.WorkflowFileName))
+		if limited && numberOfRuns[key] >= p.config.NumberOfJob {
+			continue
+		}
+		numberOfRuns[key]++
+		workflowRuns = append(workflowRuns, run)
+	}
+	p.logf("Analyzing %d workflow runs", len(workflowRuns))
+	return workflowRuns, nil
+}
+
+// matchRepository reports whether the repository is one to profile
+func (p *Profiler) matchRepository(repository string) bool {
+	if p.config.DiscoverOwner != "" && strings.HasPrefix(strings.ToLower(repository), strings.ToLower(p.config.DiscoverOwner)+"/") {
+		return true
+	}
+	for _, r := range p.config.Repositories {
+		if strings.EqualFold(r, repository) {
+			return true
+		}
+	}
+	if !p.config.IsMultiRepository() {
+		// every stored repository, or every one of the owner, is profiled without a repository
+		if p.config.Repository == "" {
+			return p.config.Owner == "" || strings.HasPrefix(strings.ToLower(repository), strings.ToLower(p.config.Owner)+"/")
+		}
+		return strings.EqualFold(RepositoryName{Owner: p.config.Owner, Name: p.config.Repository}.String(), repository)
+	}
+	return false
+}
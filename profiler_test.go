@@ -0,0 +1,394 @@
+package ghaprofiler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+var testRepository = &RepositoryName{Owner: "owner", Name: "repo"}
+
+func newTestProfiler(t *testing.T, opts ...ProfilerOption) *Profiler {
+	t.Helper()
+	p, err := NewProfiler(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func Test_ResolveWorkflowFileNames(t *testing.T) {
+	client, teardown := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.Workflows{
+			Workflows: []*github.Workflow{
+				{Path: github.String(".github/workflows/ci.yml")},
+				{Path: github.String(".github/workflows/release.yml")},
+				{Path: github.String(".github/workflows/lint.yaml")},
+			},
+		})
+	}))
+	defer teardown()
+
+	testCases := []struct {
+		config   *ProfileConfig
+		expected []string
+	}{
+		{
+			config:   &ProfileConfig{WorkflowFileName: "ci.yml"},
+			expected: []string{"ci.yml"},
+		},
+		{
+			config:   &ProfileConfig{WorkflowFiles: []string{"*.yml"}},
+			expected: []string{"ci.yml", "release.yml"},
+		},
+		{
+			config:   &ProfileConfig{WorkflowFiles: []string{"ci.yml", "l*"}},
+			expected: []string{"ci.yml", "lint.yaml"},
+		},
+		{
+			config:   &ProfileConfig{AllWorkflows: true},
+			expected: []string{"ci.yml", "lint.yaml", "release.yml"},
+		},
+	}
+	for _, tc := range testCases {
+		got, err := newTestProfiler(t, WithConfig(tc.config), WithClient(client)).resolveWorkflowFileNames(context.Background(), testRepository)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Fatalf("expected %v, got %v", tc.expected, got)
+		}
+	}
+
+	if _, err := newTestProfiler(t, WithClient(client), WithWorkflowFiles("deploy-*")).resolveWorkflowFileNames(context.Background(), testRepository); err == nil {
+		t.Fatal("Expected an error when no workflow matches")
+	}
+}
+
+func Test_ResolveRepositories(t *testing.T) {
+	client, teardown := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/orgs/utgwkk/repos":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"Not Found"}`))
+		case "/users/utgwkk/repos":
+			json.NewEncoder(w).Encode([]*github.Repository{
+				{Owner: &github.User{Login: github.String("utgwkk")}, Name: github.String("Twitter-Text")},
+				{Owner: &github.User{Login: github.String("utgwkk")}, Name: github.String("archived"), Archived: github.Bool(true)},
+				{Owner: &github.User{Login: github.String("utgwkk")}, Name: github.String("github-actions-profiler")},
+			})
+		default:
+			t.Errorf("Unexpected request: %s", r.URL.Path)
+		}
+	}))
+	defer teardown()
+
+	config := &ProfileConfig{
+		Repositories:  []string{"utgwkk/github-actions-profiler", "octocat/Hello-World"},
+		DiscoverOwner: "utgwkk",
+	}
+	repositories, err := newTestProfiler(t, WithConfig(config), WithClient(client)).resolveRepositories(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, repository := range repositories {
+		got = append(got, repository.String())
+	}
+	expected := []string{"utgwkk/github-actions-profiler", "octocat/Hello-World", "utgwkk/Twitter-Text"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func Test_CollectWorkflowJobsInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client, teardown := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/owner/repo/actions/runs/3/jobs" {
+			// interrupted while fetching jobs of the third run
+			cancel()
+			<-r.Context().Done()
+			return
+		}
+		json.NewEncoder(w).Encode(&github.Jobs{})
+	}))
+	defer teardown()
+
+	var runs []*WorkflowRun
+	for id := int64(1); id <= 5; id++ {
+		runs = append(runs, &WorkflowRun{WorkflowRun: &github.WorkflowRun{ID: github.Int64(id)}})
+	}
+	p := newTestProfiler(t, WithClient(client), WithConcurrencyLimiter(NewFixedConcurrencyLimiter(1)))
+	result, err := p.collectWorkflowJobs(ctx, testRepository, "ci.yml", runs)
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	// jobs of the first two runs are fetched
+	if len(result) != len(runs) || result[0] == nil || result[1] == nil || result[2] != nil {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if compacted := compactWorkflowRuns(result); len(compacted) != 2 {
+		t.Fatalf("expected 2 workflow runs, got %d", len(compacted))
+	}
+}
+
+func newTestRunWithSteps(workflowFileName string, id int64, jobName string, stepSeconds ...int) *WorkflowRunWithJobs {
+	run := newTestStoredRun("owner/repo", workflowFileName, id, "completed")
+	startedAt := testBaseTime
+	var steps []*github.TaskStep
+	for i, seconds := range stepSeconds {
+		completedAt := startedAt.Add(time.Duration(seconds) * time.Second)
+		steps = append(steps, &github.TaskStep{
+			Name:        github.String(fmt.Sprintf("step %d", i+1)),
+			Number:      github.Int64(int64(i + 1)),
+			Status:      github.String("completed"),
+			Conclusion:  github.String("success"),
+			StartedAt:   &github.Timestamp{Time: startedAt},
+			CompletedAt: &github.Timestamp{Time: completedAt},
+		})
+		startedAt = completedAt
+	}
+	run.Jobs[0].Name = github.String(jobName)
+	run.Jobs[0].Steps = steps
+	return run
+}
+
+func Test_ProfilerRun(t *testing.T) {
+	p := newTestProfiler(t,
+		WithWorkflowRuns([]*WorkflowRunWithJobs{
+			newTestRunWithSteps("ci.yml", 1, "test (1)", 10, 30),
+			newTestRunWithSteps("ci.yml", 2, "test (2)", 20, 10),
+			newTestRunWithSteps("release.yml", 3, "release", 60),
+		}),
+		WithWorkflowFiles("ci.yml"),
+		WithReplaceRule(`test \(\d+\)`, "test"),
+		WithSort("max", true),
+	)
+	result, err := p.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Partial || len(result.WorkflowRuns) != 2 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if len(result.Workflows) != 1 || result.Workflows[0].Name != "ci.yml" {
+		t.Fatalf("unexpected workflows: %+v", result.Workflows)
+	}
+	jobs := result.Workflows[0].Jobs
+	if len(jobs) != 1 || jobs[0].Name != "test" {
+		t.Fatalf("expected jobs aggregated by the replace rule, got %+v", jobs)
+	}
+	if jobs[0].Duration == nil || jobs[0].Duration.Executed != 2 {
+		t.Fatalf("unexpected job duration profile: %+v", jobs[0].Duration)
+	}
+	// sorted by max in descending order
+	var got []string
+	for _, step := range jobs[0].Profile {
+		got = append(got, fmt.Sprintf("%s:%v", step.Name, step.Max))
+	}
+	expected := []string{"step 2:30", "step 1:20"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func Test_ProfilerRunLevels(t *testing.T) {
+	runs := []*WorkflowRunWithJobs{newTestRunWithSteps("ci.yml", 1, "test", 10)}
+	runs[0].Jobs[0].StartedAt = &github.Timestamp{Time: runs[0].Run.GetCreatedAt().Add(5 * time.Second)}
+	testCases := []struct {
+		levels                             []string
+		hasRuns, hasDurations, hasProfiles bool
+	}{
+		{levels: nil, hasRuns: true, hasDurations: true, hasProfiles: true},
+		{levels: []string{LevelRun}, hasRuns: true},
+		{levels: []string{LevelJob, LevelStep}, hasDurations: true, hasProfiles: true},
+		{levels: []string{LevelStep}, hasProfiles: true},
+	}
+	for _, tc := range testCases {
+		result, err := newTestProfiler(t, WithWorkflowRuns(runs), WithLevels(tc.levels...)).Run(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		workflow := result.Workflows[0]
+		hasDurations, hasProfiles := false, false
+		for _, job := range workflow.Jobs {
+			hasDurations = hasDurations || job.Duration != nil
+			hasProfiles = hasProfiles || job.Profile != nil
+		}
+		if (workflow.Runs != nil) != tc.hasRuns || hasDurations != tc.hasDurations || hasProfiles != tc.hasProfiles {
+			t.Errorf("%v: unexpected profile: runs=%v, durations=%v, profiles=%v", tc.levels, workflow.Runs != nil, hasDurations, hasProfiles)
+		}
+		// start times of jobs are profiled along with job durations, as needs of jobs are unknown without revisions
+		if workflow.JobQueues != nil || (workflow.JobStartOffsets != nil) != tc.hasDurations {
+			t.Errorf("%v: unexpected job queue profile: %v, %v", tc.levels, workflow.JobQueues, workflow.JobStartOffsets)
+		}
+	}
+}
+
+func Test_ProfilerRunWithoutWorkflowRun(t *testing.T) {
+	input := `{"workflow_run": {"repository": "owner/repo", "workflow_file": "ci.yml", "jobs": [{"id": 10, "name": "test", "status": "completed", "started_at": "2020-12-01T00:00:05Z", "completed_at": "2020-12-01T00:00:15Z"}]}}
+{"workflow_runs": [null, {}]}
+`
+	runs, err := LoadWorkflowRuns(bytes.NewBufferString(input), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].Run != nil {
+		t.Fatalf("unexpected runs: %+v", runs)
+	}
+
+	result, err := newTestProfiler(t, WithWorkflowRuns(runs)).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	workflow := result.Workflows[0]
+	// the status of the workflow run is unknown, but its jobs are profiled
+	for _, metric := range workflow.Runs {
+		if metric.Runs != 0 {
+			t.Fatalf("unexpected run profile: %+v", metric)
+		}
+	}
+	if len(workflow.Jobs) != 1 || workflow.Jobs[0].Duration.Executed != 1 {
+		t.Fatalf("unexpected jobs: %+v", workflow.Jobs)
+	}
+}
+
+func Test_ProfilerRunGroupByRevision(t *testing.T) {
+	newRun := func(id int64, revision string, stepSeconds ...int) *WorkflowRunWithJobs {
+		run := newTestRunWithSteps("ci.yml", id, "test", stepSeconds...)
+		run.Revision = revision
+		return run
+	}
+	runs := []*WorkflowRunWithJobs{
+		newRun(1, "aaaa1111", 10),
+		newRun(2, "bbbb2222", 20, 5),
+		newRun(3, "aaaa1111", 30),
+		newRun(4, "", 40),
+	}
+
+	result, err := newTestProfiler(t, WithWorkflowRuns(runs), WithGroupByRevision()).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// from the revision of the newest run
+	var got []string
+	for _, workflow := range result.Workflows {
+		got = append(got, fmt.Sprintf("%s:%v", workflow.Revision, workflow.Jobs[0].Duration.Executed))
+	}
+	expected := []string{"unknown:1", "aaaa1111:2", "bbbb2222:1"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	result, err = newTestProfiler(t, WithWorkflowRuns(runs), WithRevisions("bbbb")).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Workflows) != 1 || result.Workflows[0].Revision != "" || len(result.Workflows[0].Jobs[0].Profile) != 2 {
+		t.Fatalf("expected only runs of the revision: %+v", result.Workflows)
+	}
+}
+
+func Test_ProfilerRunInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client, teardown := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m := testRunPathPattern.FindStringSubmatch(r.URL.Path); m != nil {
+			if m[1] == "3" {
+				cancel()
+				<-r.Context().Done()
+				return
+			}
+			json.NewEncoder(w).Encode(&github.Jobs{})
+			return
+		}
+		var list []*github.WorkflowRun
+		for id := int64(1); id <= 4; id++ {
+			list = append(list, newTestStoredRun("owner/repo", "ci.yml", id, "completed").Run)
+		}
+		json.NewEncoder(w).Encode(&github.WorkflowRuns{WorkflowRuns: list})
+	}))
+	defer teardown()
+
+	p := newTestProfiler(t,
+		WithClient(client),
+		WithConcurrencyLimiter(NewFixedConcurrencyLimiter(1)),
+		WithRepository("owner", "repo"),
+		WithWorkflowFiles("ci.yml"),
+	)
+	result, err := p.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Partial || len(result.WorkflowRuns) != 2 {
+		t.Fatalf("expected 2 workflow runs in a partial result, got %+v", result)
+	}
+	for _, workflow := range result.Workflows {
+		if !workflow.Partial {
+			t.Fatalf("expected a partial profile: %+v", workflow)
+		}
+	}
+}
+
+func Test_NewProfilerInvalidOption(t *testing.T) {
+	testCases := []ProfilerOption{
+		WithConfig(nil),
+		WithRepositories("no-slash"),
+		WithNumberOfRuns(0),
+		WithStatus("unknown"),
+		WithJobNameRegexp("("),
+		WithReplaceRule("(", ""),
+		WithSort("unknown", false),
+		WithTimeRange(testBaseTime, testBaseTime.Add(-time.Hour)),
+	}
+	for i, opt := range testCases {
+		if _, err := NewProfiler(opt); err == nil {
+			t.Errorf("case %d: expected an error", i)
+		}
+	}
+}
+
+func Test_WithConfigDoesNotModifyConfig(t *testing.T) {
+	config := DefaultProfileConfig()
+	// spare capacity which appending options would write into
+	config.WorkflowFiles = make([]string, 1, 4)
+	config.WorkflowFiles[0] = "ci.yml"
+	config.Levels = make([]string, 0, 4)
+
+	for _, workflowFile := range []string{"release.yml", "deploy.yml"} {
+		p := newTestProfiler(t,
+			WithConfig(config),
+			WithWorkflowRuns([]*WorkflowRunWithJobs{newTestRunWithSteps("ci.yml", 1, "test", 10)}),
+			WithWorkflowFiles(workflowFile),
+			WithLevels(LevelRun),
+			WithNumberOfRuns(5),
+		)
+		if _, err := p.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if expected := []string{"ci.yml", workflowFile}; !reflect.DeepEqual(p.config.WorkflowFiles, expected) {
+			t.Fatalf("expected %v, got %v", expected, p.config.WorkflowFiles)
+		}
+	}
+	if len(config.WorkflowFiles) != 1 || config.WorkflowFiles[:2][1] != "" || len(config.Levels) != 0 || config.Levels[:1][0] != "" {
+		t.Fatalf("config is modified: %+v", config)
+	}
+	if config.NumberOfJob != DefaultProfileConfig().NumberOfJob {
+		t.Fatalf("config is modified: number-of-job=%d", config.NumberOfJob)
+	}
+}
+
+func Test_ProfilerRunRequiresRepository(t *testing.T) {
+	p := newTestProfiler(t, WithWorkflowFiles("ci.yml"))
+	if _, err := p.Run(context.Background()); err == nil {
+		t.Fatal("expected an error without a repository")
+	}
+}
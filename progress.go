@@ -0,0 +1,240 @@
+package ghaprofiler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// interactiveProgressInterval is how often the status line is redrawn on a terminal
+	interactiveProgressInterval = 200 * time.Millisecond
+	// plainProgressInterval is how often a status line is written when the output is not a terminal
+	plainProgressInterval = 10 * time.Second
+)
+
+// Progress reports progress of fetching workflow runs and their jobs.
+// On a terminal it redraws a status line, and otherwise it writes a status line periodically.
+// Methods of a nil *Progress do nothing.
+type Progress struct {
+	mu          sync.Mutex
+	w           io.Writer
+	interactive bool
+	interval    time.Duration
+
+	listedRuns  int
+	jobsToFetch int
+	fetchedJobs int
+	cacheHits   int
+	// rateLimitRemaining is -1 until a response tells it
+	rateLimitRemaining int
+	startedAt          time.Time
+	// lineShown is true while the status line is drawn on a terminal
+	lineShown bool
+	stopCh    chan struct{}
+	doneCh    chan struct{}
+}
+
+// NewProgress returns a progress which writes to w, redrawing a status line if w is a terminal
+func NewProgress(w io.Writer) *Progress {
+	return newProgress(w, isTerminal(w))
+}
+
+func newProgress(w io.Writer, interactive bool) *Progress {
+	interval := plainProgressInterval
+	if interactive {
+		interval = interactiveProgressInterval
+	}
+	return &Progress{
+		w:                  w,
+		interactive:        interactive,
+		interval:           interval,
+		rateLimitRemaining: -1,
+	}
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Writer returns a writer for log messages, which clears the status line before a message
+// and redraws it after the message so that they are not mixed up
+func (p *Progress) Writer() io.Writer {
+	return progressLogWriter{progress: p}
+}
+
+type progressLogWriter struct {
+	progress *Progress
+}
+
+func (w progressLogWriter) Write(b []byte) (int, error) {
+	p := w.progress
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clearLine()
+	n, err := p.w.Write(b)
+	if p.interactive && p.stopCh != nil {
+		p.drawLine(time.Now())
+	}
+	return n, err
+}
+
+// start resets counters and starts reporting
+func (p *Progress) start() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopCh != nil {
+		return
+	}
+	p.listedRuns = 0
+	p.jobsToFetch = 0
+	p.fetchedJobs = 0
+	p.cacheHits = 0
+	p.startedAt = time.Now()
+	p.stopCh = make(chan struct{})
+	p.doneCh = make(chan struct{})
+	go p.loop(p.stopCh, p.doneCh)
+}
+
+func (p *Progress) loop(stopCh, doneCh chan struct{}) {
+	defer close(doneCh)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case now := <-ticker.C:
+			p.mu.Lock()
+			p.drawLine(now)
+			p.mu.Unlock()
+		}
+	}
+}
+
+// stop stops reporting and writes the final status line if anything is fetched
+func (p *Progress) stop() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	stopCh, doneCh := p.stopCh, p.doneCh
+	p.stopCh, p.doneCh = nil, nil
+	p.mu.Unlock()
+	if stopCh == nil {
+		return
+	}
+	close(stopCh)
+	<-doneCh
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clearLine()
+	if p.listedRuns > 0 || p.jobsToFetch > 0 {
+		fmt.Fprintln(p.w, p.status(time.Now()))
+	}
+}
+
+// drawLine draws the status line, where p.mu is held
+func (p *Progress) drawLine(now time.Time) {
+	if p.interactive {
+		fmt.Fprintf(p.w, "\r\x1b[K%s", p.status(now))
+		p.lineShown = true
+		return
+	}
+	fmt.Fprintln(p.w, p.status(now))
+}
+
+// clearLine clears the status line on a terminal, where p.mu is held
+func (p *Progress) clearLine() {
+	if !p.lineShown {
+		return
+	}
+	fmt.Fprint(p.w, "\r\x1b[K")
+	p.lineShown = false
+}
+
+// status describes progress, where p.mu is held
+func (p *Progress) status(now time.Time) string {
+	parts := []string{
+		fmt.Sprintf("%d runs listed", p.listedRuns),
+		fmt.Sprintf("jobs of %d/%d runs fetched", p.fetchedJobs, p.jobsToFetch),
+		fmt.Sprintf("%d cache hits", p.cacheHits),
+	}
+	if p.rateLimitRemaining >= 0 {
+		parts = append(parts, fmt.Sprintf("rate limit %d remaining", p.rateLimitRemaining))
+	}
+	if p.fetchedJobs > 0 && p.fetchedJobs < p.jobsToFetch {
+		elapsed := now.Sub(p.startedAt)
+		eta := elapsed * time.Duration(p.jobsToFetch-p.fetchedJobs) / time.Duration(p.fetchedJobs)
+		parts = append(parts, fmt.Sprintf("ETA %v", eta.Round(time.Second)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (p *Progress) addListedRuns(n int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.listedRuns += n
+}
+
+func (p *Progress) addJobsToFetch(n int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.jobsToFetch += n
+}
+
+func (p *Progress) jobsFetched() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fetchedJobs++
+}
+
+// ObserveCacheHit implements CacheObserver
+func (p *Progress) ObserveCacheHit() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cacheHits++
+}
+
+// ObserveResponse implements ResponseObserver to track the remaining rate limit
+func (p *Progress) ObserveResponse(resp *http.Response, latency time.Duration) {
+	if p == nil {
+		return
+	}
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rateLimitRemaining = remaining
+}
@@ -0,0 +1,122 @@
+package ghaprofiler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+func Test_ProgressStatus(t *testing.T) {
+	var buf bytes.Buffer
+	progress := newProgress(&buf, false)
+	progress.start()
+	progress.addListedRuns(10)
+	progress.addJobsToFetch(10)
+	for i := 0; i < 4; i++ {
+		progress.jobsFetched()
+	}
+	progress.ObserveCacheHit()
+	progress.ObserveResponse(&http.Response{Header: http.Header{"X-Ratelimit-Remaining": []string{"4999"}}}, time.Second)
+	progress.stop()
+
+	got := buf.String()
+	for _, expected := range []string{"10 runs listed", "jobs of 4/10 runs fetched", "1 cache hits", "rate limit 4999 remaining", "ETA "} {
+		if !strings.Contains(got, expected) {
+			t.Errorf("expected %q in %q", expected, got)
+		}
+	}
+	if strings.Contains(got, "\x1b") {
+		t.Errorf("expected no escape sequence when the output is not a terminal: %q", got)
+	}
+}
+
+func Test_ProgressLogWriter(t *testing.T) {
+	var buf bytes.Buffer
+	progress := newProgress(&buf, true)
+	progress.start()
+	progress.addListedRuns(1)
+	progress.mu.Lock()
+	progress.drawLine(time.Now())
+	progress.mu.Unlock()
+	progress.Writer().Write([]byte("message\n"))
+	progress.stop()
+
+	// the status line is cleared before the message and redrawn after it
+	got := buf.String()
+	i := strings.Index(got, "\r\x1b[Kmessage\n\r\x1b[K1 runs listed")
+	if i < 0 {
+		t.Fatalf("unexpected output: %q", got)
+	}
+	if !strings.HasSuffix(got, "\r\x1b[K1 runs listed, jobs of 0/0 runs fetched, 0 cache hits\n") {
+		t.Fatalf("expected the final status line: %q", got)
+	}
+}
+
+func Test_ProgressNil(t *testing.T) {
+	var progress *Progress
+	progress.start()
+	progress.addListedRuns(1)
+	progress.addJobsToFetch(1)
+	progress.jobsFetched()
+	progress.ObserveCacheHit()
+	progress.stop()
+}
+
+func Test_ProgressObservesClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "private, max-age=60, s-maxage=60")
+		w.Header().Set("X-RateLimit-Remaining", "4321")
+		if strings.HasSuffix(r.URL.Path, "/jobs") {
+			json.NewEncoder(w).Encode(&github.Jobs{
+				Jobs: []*github.WorkflowJob{{ID: github.Int64(1), Status: github.String("completed")}},
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(&github.Workflows{})
+	}))
+	defer server.Close()
+
+	progress := newProgress(ioutil.Discard, false)
+	client, err := NewClientWithConfig(context.Background(), &ClientConfig{
+		BaseURL:          server.URL,
+		Cache:            true,
+		CacheDirectory:   dir,
+		ResponseObserver: progress,
+		CacheObserver:    progress,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := &github.WorkflowRun{ID: github.Int64(1), Status: github.String("completed"), UpdatedAt: &github.Timestamp{Time: testBaseTime}}
+	for i := 0; i < 2; i++ {
+		// served by the HTTP cache for the second time
+		if _, err := client.ListAllWorkflows(context.Background(), "owner", "repo"); err != nil {
+			t.Fatal(err)
+		}
+		// served by the immutable cache for the second time
+		if _, err := client.ListAllWorkflowJobsOfRun(context.Background(), "owner", "repo", run, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if progress.cacheHits != 2 {
+		t.Errorf("expected 2 cache hits, got %d", progress.cacheHits)
+	}
+	if progress.rateLimitRemaining != 4321 {
+		t.Errorf("expected rate limit 4321, got %d", progress.rateLimitRemaining)
+	}
+}
@@ -0,0 +1,82 @@
+package ghaprofiler
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// RemoteURL is a git remote URL pointing to a repository on GitHub
+type RemoteURL struct {
+	// Host is the host name without a port
+	Host       string
+	Repository RepositoryName
+}
+
+// ParseRemoteURL parses a git remote URL in any of the following forms:
+//
+//	git@github.com:owner/repo.git
+//	ssh://git@github.com:2222/owner/repo.git
+//	https://github.com/owner/repo.git
+//	git://github.com/owner/repo.git
+func ParseRemoteURL(remoteURL string) (*RemoteURL, error) {
+	var host, repositoryPath string
+	if strings.Contains(remoteURL, "://") {
+		u, err := url.Parse(remoteURL)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid remote URL: %v", err)
+		}
+		switch u.Scheme {
+		case "ssh", "git+ssh", "ssh+git", "git", "http", "https":
+		default:
+			return nil, fmt.Errorf("Unsupported scheme of remote URL: %s", u.Scheme)
+		}
+		host, repositoryPath = u.Hostname(), u.Path
+	} else {
+		// scp-like syntax: [user@]host:path
+		colonPos := strings.Index(remoteURL, ":")
+		// C:\path is a Windows path
+		if colonPos <= 1 || strings.Contains(remoteURL[:colonPos], "/") {
+			return nil, fmt.Errorf("Remote URL is not a URL but a local path")
+		}
+		host = remoteURL[strings.LastIndex(remoteURL[:colonPos], "@")+1 : colonPos]
+		repositoryPath = remoteURL[colonPos+1:]
+	}
+	if host == "" {
+		return nil, fmt.Errorf("Remote URL has no host")
+	}
+
+	repositoryPath = strings.Trim(repositoryPath, "/")
+	repositoryPath = strings.TrimSuffix(repositoryPath, ".git")
+	segments := strings.Split(repositoryPath, "/")
+	if len(segments) < 2 {
+		return nil, fmt.Errorf("Remote URL has no owner and repository name")
+	}
+	owner, name := segments[len(segments)-2], segments[len(segments)-1]
+	if owner == "" || name == "" {
+		return nil, fmt.Errorf("Remote URL has no owner and repository name")
+	}
+	return &RemoteURL{
+		Host:       strings.ToLower(host),
+		Repository: RepositoryName{Owner: owner, Name: name},
+	}, nil
+}
+
+// APIURLs returns the base URL and the upload URL of GitHub Enterprise Server API of the remote,
+// or empty URLs if the remote is on github.com. Only hosts in enterpriseHosts are used as GitHub Enterprise Server.
+func (r RemoteURL) APIURLs(enterpriseHosts []string) (baseURL, uploadURL string, err error) {
+	if r.IsGitHubDotCom() {
+		return "", "", nil
+	}
+	for _, host := range enterpriseHosts {
+		if strings.EqualFold(host, r.Host) {
+			return fmt.Sprintf("https://%s/api/v3/", r.Host), fmt.Sprintf("https://%s/api/uploads/", r.Host), nil
+		}
+	}
+	return "", "", fmt.Errorf("Unknown host of remote: %s (pass base-url or enterprise-hosts for GitHub Enterprise Server)", r.Host)
+}
+
+// IsGitHubDotCom reports whether the remote is on github.com instead of GitHub Enterprise Server
+func (r RemoteURL) IsGitHubDotCom() bool {
+	return isGitHubDotCom(r.Host) || r.Host == "ssh.github.com" || r.Host == "www.github.com"
+}
@@ -0,0 +1,28 @@
+package ghaprofiler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RepositoryName is a pair of a repository owner and a repository name
+type RepositoryName struct {
+	Owner string
+	Name  string
+}
+
+// ParseRepositoryName parses "owner/repo" form
+func ParseRepositoryName(s string) (*RepositoryName, error) {
+	splitted := strings.Split(s, "/")
+	if len(splitted) != 2 || splitted[0] == "" || splitted[1] == "" {
+		return nil, fmt.Errorf("Invalid repository: %s (must be owner/repo)", s)
+	}
+	return &RepositoryName{
+		Owner: splitted[0],
+		Name:  splitted[1],
+	}, nil
+}
+
+func (r RepositoryName) String() string {
+	return r.Owner + "/" + r.Name
+}
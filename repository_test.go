@@ -0,0 +1,22 @@
+package ghaprofiler
+
+import "testing"
+
+func Test_ParseRepositoryName(t *testing.T) {
+	repository, err := ParseRepositoryName("utgwkk/Twitter-Text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repository.Owner != "utgwkk" || repository.Name != "Twitter-Text" {
+		t.Fatalf("Unexpected repository: %#v", repository)
+	}
+	if repository.String() != "utgwkk/Twitter-Text" {
+		t.Fatalf("Unexpected string: %s", repository.String())
+	}
+
+	for _, invalid := range []string{"", "utgwkk", "utgwkk/", "/Twitter-Text", "a/b/c"} {
+		if _, err := ParseRepositoryName(invalid); err == nil {
+			t.Fatalf("Expected an error for %#v", invalid)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package ghaprofiler
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultMaxRetries       = 5
+	defaultMinBackoff       = 1 * time.Second
+	defaultMaxBackoff       = 1 * time.Minute
+	defaultMaxRateLimitWait = 1 * time.Hour
+)
+
+// retryTransport retries requests which failed by rate limits or transient server errors
+type retryTransport struct {
+	Transport        http.RoundTripper
+	MaxRetries       int
+	MinBackoff       time.Duration
+	MaxBackoff       time.Duration
+	MaxRateLimitWait time.Duration
+	Verbose          bool
+	// Logger receives retry and rate limit messages; the standard logger is used if nil
+	Logger *log.Logger
+
+	// sleep is replaced in tests
+	sleep func(req *http.Request, d time.Duration) error
+	now   func() time.Time
+}
+
+func newRetryTransport(transport http.RoundTripper, maxRetries int, verbose bool) *retryTransport {
+	return &retryTransport{
+		Transport:        transport,
+		MaxRetries:       maxRetries,
+		MinBackoff:       defaultMinBackoff,
+		MaxBackoff:       defaultMaxBackoff,
+		MaxRateLimitWait: defaultMaxRateLimitWait,
+		Verbose:          verbose,
+		sleep:            sleepWithContext,
+		now:              time.Now,
+	}
+}
+
+func sleepWithContext(req *http.Request, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+		return req.Context().Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, errors.New("cannot retry a request whose body cannot be rewound")
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := t.Transport.RoundTrip(req)
+		if err != nil {
+			if req.Context().Err() != nil || attempt >= t.MaxRetries {
+				return nil, err
+			}
+			wait := t.backoff(attempt)
+			t.logf("Request to %s failed: %v; retrying in %v", req.URL.Path, err, wait)
+			if err := t.sleep(req, wait); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		t.logRateLimit(resp)
+
+		wait, retry, err := t.retryDelay(resp, attempt)
+		if err != nil {
+			return nil, err
+		}
+		if !retry {
+			if err := t.waitForExhaustedRateLimit(req, resp); err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+			return resp, nil
+		}
+		if attempt >= t.MaxRetries {
+			return resp, nil
+		}
+
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		t.logf("Request to %s responded %s; retrying in %v", req.URL.Path, resp.Status, wait)
+		if err := t.sleep(req, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// logf writes a message to Logger, or to the standard logger if Logger is nil
+func (t *retryTransport) logf(format string, args ...interface{}) {
+	if t.Logger != nil {
+		t.Logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// retryDelay decides whether to retry the response and how long to wait before it
+func (t *retryTransport) retryDelay(resp *http.Response, attempt int) (time.Duration, bool, error) {
+	switch resp.StatusCode {
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		// secondary rate limit
+		if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+			if wait, ok := t.parseRetryAfter(retryAfter); ok {
+				return t.jitter(wait), wait <= t.MaxRateLimitWait, nil
+			}
+		}
+		// primary rate limit
+		if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+			if reset, ok := parseRateLimitReset(resp); ok {
+				wait := reset.Sub(t.now()) + time.Second
+				if wait < 0 {
+					wait = 0
+				}
+				return wait, wait <= t.MaxRateLimitWait, nil
+			}
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return t.backoff(attempt), true, nil
+		}
+		// secondary rate limit without Retry-After header is told only by its message
+		isSecondaryRateLimit, err := responseBodyContains(resp, "secondary rate limit", "abuse detection")
+		if err != nil {
+			return 0, false, err
+		}
+		return t.backoff(attempt), isSecondaryRateLimit, nil
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return t.backoff(attempt), true, nil
+	}
+	return 0, false, nil
+}
+
+// waitForExhaustedRateLimit waits for the reset of the rate limit when resp used up the rate limit,
+// because go-github refuses further requests until the reset without sending them
+func (t *retryTransport) waitForExhaustedRateLimit(req *http.Request, resp *http.Response) error {
+	if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		return nil
+	}
+	reset, ok := parseRateLimitReset(resp)
+	if !ok {
+		return nil
+	}
+	wait := reset.Sub(t.now()) + time.Second
+	if wait <= 0 || wait > t.MaxRateLimitWait {
+		return nil
+	}
+	t.logf("Rate limit exhausted; waiting %v for the reset", wait)
+	return t.sleep(req, wait)
+}
+
+// backoff returns an exponential backoff with jitter
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	wait := t.MinBackoff << uint(attempt)
+	if wait > t.MaxBackoff || wait <= 0 {
+		wait = t.MaxBackoff
+	}
+	return t.jitter(wait)
+}
+
+// jitter returns a random duration between d and 1.5d
+func (t *retryTransport) jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return d + time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
+func (t *retryTransport) parseRetryAfter(value string) (time.Duration, bool) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return date.Sub(t.now()), true
+	}
+	return 0, false
+}
+
+func parseRateLimitReset(resp *http.Response) (time.Time, bool) {
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(reset, 0), true
+}
+
+// responseBodyContains reads the body of resp and puts it back so that it can be read again
+func responseBodyContains(resp *http.Response, substrs ...string) (bool, error) {
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return false, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	lowerBody := strings.ToLower(string(body))
+	for _, substr := range substrs {
+		if strings.Contains(lowerBody, substr) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (t *retryTransport) logRateLimit(resp *http.Response) {
+	if !t.Verbose {
+		return
+	}
+	remaining := resp.Header.Get("X-RateLimit-Remaining")
+	if remaining == "" {
+		return
+	}
+	var resetIn time.Duration
+	if reset, ok := parseRateLimitReset(resp); ok {
+		resetIn = reset.Sub(t.now()).Truncate(time.Second)
+	}
+	t.logf("Rate limit: remaining=%s/%s, reset in %v", remaining, resp.Header.Get("X-RateLimit-Limit"), resetIn)
+}
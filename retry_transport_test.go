@@ -0,0 +1,171 @@
+package ghaprofiler
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestRetryTransport(sleeps *[]time.Duration) *retryTransport {
+	transport := newRetryTransport(http.DefaultTransport, 3, false)
+	transport.sleep = func(req *http.Request, d time.Duration) error {
+		*sleeps = append(*sleeps, d)
+		return nil
+	}
+	return transport
+}
+
+func Test_RetryTransport_ServerError(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	var sleeps []time.Duration
+	client := &http.Client{Transport: newTestRetryTransport(&sleeps)}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if len(sleeps) != 2 {
+		t.Fatalf("expected 2 retries, got %d", len(sleeps))
+	}
+	// exponential backoff with jitter
+	if sleeps[0] < defaultMinBackoff || sleeps[0] > defaultMinBackoff*3/2 {
+		t.Fatalf("unexpected first backoff: %v", sleeps[0])
+	}
+	if sleeps[1] < 2*defaultMinBackoff || sleeps[1] > 3*defaultMinBackoff {
+		t.Fatalf("unexpected second backoff: %v", sleeps[1])
+	}
+}
+
+func Test_RetryTransport_GiveUp(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	var sleeps []time.Duration
+	client := &http.Client{Transport: newTestRetryTransport(&sleeps)}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", resp.StatusCode)
+	}
+	if len(sleeps) != 3 {
+		t.Fatalf("expected 3 retries, got %d", len(sleeps))
+	}
+}
+
+func Test_RetryTransport_RetryAfter(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	var sleeps []time.Duration
+	client := &http.Client{Transport: newTestRetryTransport(&sleeps)}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(sleeps) != 1 || sleeps[0] < 30*time.Second || sleeps[0] > 45*time.Second {
+		t.Fatalf("unexpected sleeps: %v", sleeps)
+	}
+}
+
+func Test_RetryTransport_RateLimitReset(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(now.Add(10*time.Minute).Unix(), 10))
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	var sleeps []time.Duration
+	transport := newTestRetryTransport(&sleeps)
+	transport.now = func() time.Time { return now }
+	client := &http.Client{Transport: transport}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(sleeps) != 1 || sleeps[0] != 10*time.Minute+time.Second {
+		t.Fatalf("unexpected sleeps: %v", sleeps)
+	}
+}
+
+func Test_RetryTransport_NotRetried(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message":"Resource not accessible by integration"}`))
+	}))
+	defer server.Close()
+
+	var sleeps []time.Duration
+	client := &http.Client{Transport: newTestRetryTransport(&sleeps)}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(sleeps) != 0 {
+		t.Fatalf("unexpected retries: %v", sleeps)
+	}
+}
+
+func Test_RetryTransport_Logger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	var sleeps []time.Duration
+	var buf bytes.Buffer
+	transport := newTestRetryTransport(&sleeps)
+	transport.Logger = log.New(&buf, "", 0)
+	client := &http.Client{Transport: transport}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if lines := strings.Count(buf.String(), "retrying in"); lines != 3 {
+		t.Fatalf("expected 3 retry messages to the logger, got %d: %q", lines, buf.String())
+	}
+}
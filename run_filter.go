@@ -0,0 +1,132 @@
+package ghaprofiler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+var availableRunStatuses = []string{
+	"queued",
+	"in_progress",
+	"completed",
+}
+
+var availableRunConclusions = []string{
+	"action_required",
+	"cancelled",
+	"failure",
+	"neutral",
+	"skipped",
+	"stale",
+	"success",
+	"timed_out",
+}
+
+func containsString(xs []string, s string) bool {
+	for _, x := range xs {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func IsValidRunStatus(status string) bool {
+	// status parameter of the API also accepts a conclusion
+	return containsString(availableRunStatuses, status) || containsString(availableRunConclusions, status)
+}
+
+func IsValidRunConclusion(conclusion string) bool {
+	return containsString(availableRunConclusions, conclusion)
+}
+
+// WorkflowRunFilter selects workflow runs on the client side.
+// Branch, Event and Status are also filtered by the API when runs are fetched from GitHub.
+type WorkflowRunFilter struct {
+	Branch     string
+	Event      string
+	Status     string
+	Conclusion string
+	Since      time.Time
+	Until      time.Time
+}
+
+// Match reports whether run satisfies the filter
+func (f *WorkflowRunFilter) Match(run *github.WorkflowRun) bool {
+	if f == nil {
+		return true
+	}
+	if f.Branch != "" && run.GetHeadBranch() != f.Branch {
+		return false
+	}
+	if f.Event != "" && run.GetEvent() != f.Event {
+		return false
+	}
+	// status parameter of the API also accepts a conclusion
+	if f.Status != "" && run.GetStatus() != f.Status && run.GetConclusion() != f.Status {
+		return false
+	}
+	if f.Conclusion != "" && run.GetConclusion() != f.Conclusion {
+		return false
+	}
+	createdAt := run.GetCreatedAt().Time
+	if !f.Since.IsZero() && createdAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && createdAt.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// IsBeforeRange reports whether run was created before the range of the filter.
+// Workflow runs are listed from newest to oldest, so no more runs can match after it.
+func (f *WorkflowRunFilter) IsBeforeRange(run *github.WorkflowRun) bool {
+	if f == nil || f.Since.IsZero() {
+		return false
+	}
+	return run.GetCreatedAt().Time.Before(f.Since)
+}
+
+var relativeTimeSpecRegexp = regexp.MustCompile(`^([0-9]+)([smhdw])$`)
+
+var relativeTimeSpecUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+const dateTimeSpecLayout = "2006-01-02"
+
+// ParseTimeSpec parses an absolute time (RFC 3339 or YYYY-MM-DD)
+// or a relative time such as "14d" which means 14 days before now
+func ParseTimeSpec(spec string, now time.Time) (time.Time, error) {
+	if m := relativeTimeSpecRegexp.FindStringSubmatch(spec); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(-time.Duration(n) * relativeTimeSpecUnits[m[2]]), nil
+	}
+	if t, err := time.Parse(time.RFC3339, spec); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(dateTimeSpecLayout, spec); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("Invalid time: %s", spec)
+}
+
+// ParseUntilTimeSpec is ParseTimeSpec for the end of a range, where YYYY-MM-DD means the end of the day
+func ParseUntilTimeSpec(spec string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(dateTimeSpecLayout, spec); err == nil {
+		return t.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+	}
+	return ParseTimeSpec(spec, now)
+}
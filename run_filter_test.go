@@ -0,0 +1,98 @@
+package ghaprofiler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+func Test_ParseTimeSpec(t *testing.T) {
+	now := time.Date(2020, 12, 15, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"14d", time.Date(2020, 12, 1, 12, 0, 0, 0, time.UTC)},
+		{"2w", time.Date(2020, 12, 1, 12, 0, 0, 0, time.UTC)},
+		{"3h", time.Date(2020, 12, 15, 9, 0, 0, 0, time.UTC)},
+		{"2020-12-01", time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)},
+		{"2020-12-01T09:30:00Z", time.Date(2020, 12, 1, 9, 30, 0, 0, time.UTC)},
+	}
+	for _, tc := range testCases {
+		got, err := ParseTimeSpec(tc.spec, now)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.spec, err)
+		}
+		if !got.Equal(tc.expected) {
+			t.Fatalf("%s: expected %v, got %v", tc.spec, tc.expected, got)
+		}
+	}
+
+	if _, err := ParseTimeSpec("yesterday", now); err == nil {
+		t.Fatal("Expected an error for an invalid time")
+	}
+}
+
+func Test_ParseUntilTimeSpec(t *testing.T) {
+	now := time.Date(2020, 12, 15, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		spec     string
+		expected time.Time
+	}{
+		// the whole day is included
+		{"2020-12-01", time.Date(2020, 12, 1, 23, 59, 59, 999999999, time.UTC)},
+		{"2020-12-01T09:30:00Z", time.Date(2020, 12, 1, 9, 30, 0, 0, time.UTC)},
+		{"3h", time.Date(2020, 12, 15, 9, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range testCases {
+		got, err := ParseUntilTimeSpec(tc.spec, now)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.spec, err)
+		}
+		if !got.Equal(tc.expected) {
+			t.Fatalf("%s: expected %v, got %v", tc.spec, tc.expected, got)
+		}
+	}
+
+	config := DefaultProfileConfig()
+	config.Since = "2020-12-01"
+	config.Until = "2020-12-01"
+	filter, err := config.WorkflowRunFilter(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filter.Match(&github.WorkflowRun{CreatedAt: &github.Timestamp{Time: time.Date(2020, 12, 1, 18, 0, 0, 0, time.UTC)}}) {
+		t.Fatal("a run created on the day of until must match")
+	}
+	if filter.Match(&github.WorkflowRun{CreatedAt: &github.Timestamp{Time: time.Date(2020, 12, 2, 0, 0, 0, 0, time.UTC)}}) {
+		t.Fatal("a run created on the next day of until must not match")
+	}
+}
+
+func Test_WorkflowRunFilter(t *testing.T) {
+	filter := &WorkflowRunFilter{
+		Conclusion: "success",
+		Since:      time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC),
+		Until:      time.Date(2020, 12, 10, 0, 0, 0, 0, time.UTC),
+	}
+	newRun := func(conclusion string, createdAt time.Time) *github.WorkflowRun {
+		return &github.WorkflowRun{
+			Conclusion: github.String(conclusion),
+			CreatedAt:  &github.Timestamp{Time: createdAt},
+		}
+	}
+
+	if !filter.Match(newRun("success", time.Date(2020, 12, 5, 0, 0, 0, 0, time.UTC))) {
+		t.Fatal("Expected a successful run in the range to match")
+	}
+	if filter.Match(newRun("cancelled", time.Date(2020, 12, 5, 0, 0, 0, 0, time.UTC))) {
+		t.Fatal("Unexpected match of a cancelled run")
+	}
+	if filter.Match(newRun("success", time.Date(2020, 12, 11, 0, 0, 0, 0, time.UTC))) {
+		t.Fatal("Unexpected match of a run after until")
+	}
+	if !filter.IsBeforeRange(newRun("success", time.Date(2020, 11, 30, 0, 0, 0, 0, time.UTC))) {
+		t.Fatal("Expected a run before since to be before the range")
+	}
+}
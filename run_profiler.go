@@ -0,0 +1,88 @@
+package ghaprofiler
+
+import "time"
+
+const (
+	runMetricQueue   = "Queue"
+	runMetricWall    = "Wall"
+	runMetricCompute = "Compute"
+)
+
+// RunMetricProfile is statistics of a metric of workflow runs in seconds
+type RunMetricProfile struct {
+	Name        string                    `json:"name"`
+	Min         float64                   `json:"min"`
+	Max         float64                   `json:"max"`
+	Median      float64                   `json:"median"`
+	Mean        float64                   `json:"mean"`
+	Percentiles map[int64]*percentileData `json:"percentiles"`
+	// Runs is the number of workflow runs which have the metric
+	Runs int `json:"runs"`
+}
+
+const runStatusCompleted = "completed"
+
+// ProfileWorkflowRunTimes profiles completed workflow runs with every job of them by
+// time to the first job (queue), wall-clock time and the sum of job durations (compute)
+func ProfileWorkflowRunTimes(workflowRuns []*WorkflowRunWithJobs) ([]*RunMetricProfile, error) {
+	var queues, walls, computes []float64
+	for _, run := range workflowRuns {
+		if run.Run.GetStatus() != runStatusCompleted {
+			continue
+		}
+		startedAt, ok := workflowRunStartedAt(run)
+		if !ok {
+			continue
+		}
+
+		var firstJobStartedAt time.Time
+		var compute float64
+		for _, job := range run.Jobs {
+			if elapsedSeconds, ok := workflowJobElapsedSeconds(job); ok {
+				compute += elapsedSeconds
+			}
+			// skipped jobs never wait for a runner
+			if job.StartedAt == nil || job.GetConclusion() == jobConclusionSkipped {
+				continue
+			}
+			if firstJobStartedAt.IsZero() || job.StartedAt.Before(firstJobStartedAt) {
+				firstJobStartedAt = job.StartedAt.Time
+			}
+		}
+		if !firstJobStartedAt.IsZero() {
+			queues = append(queues, firstJobStartedAt.Sub(startedAt).Seconds())
+		}
+		// updated_at of a completed workflow run is when it completed
+		if updatedAt := run.Run.GetUpdatedAt(); !updatedAt.IsZero() {
+			walls = append(walls, updatedAt.Sub(startedAt).Seconds())
+		}
+		if len(run.Jobs) > 0 {
+			computes = append(computes, compute)
+		}
+	}
+
+	var profiles []*RunMetricProfile
+	for _, metric := range []struct {
+		name    string
+		samples []float64
+	}{
+		{name: runMetricQueue, samples: queues},
+		{name: runMetricWall, samples: walls},
+		{name: runMetricCompute, samples: computes},
+	} {
+		durationStats, err := calculateDurationStats(metric.samples)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, &RunMetricProfile{
+			Name:        metric.name,
+			Min:         durationStats.Min,
+			Max:         durationStats.Max,
+			Median:      durationStats.Median,
+			Mean:        durationStats.Mean,
+			Percentiles: durationStats.Percentiles,
+			Runs:        len(metric.samples),
+		})
+	}
+	return profiles, nil
+}
@@ -0,0 +1,76 @@
+package ghaprofiler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+func newTestTimedJob(conclusion string, startedAfter, elapsed time.Duration) *github.WorkflowJob {
+	return &github.WorkflowJob{
+		Status:      github.String("completed"),
+		Conclusion:  github.String(conclusion),
+		StartedAt:   &github.Timestamp{Time: testBaseTime.Add(startedAfter)},
+		CompletedAt: &github.Timestamp{Time: testBaseTime.Add(startedAfter + elapsed)},
+	}
+}
+
+func Test_ProfileWorkflowRunTimes(t *testing.T) {
+	newRun := func(status string, wall time.Duration, jobs ...*github.WorkflowJob) *WorkflowRunWithJobs {
+		return &WorkflowRunWithJobs{
+			Run: &github.WorkflowRun{
+				Status:    github.String(status),
+				CreatedAt: &github.Timestamp{Time: testBaseTime},
+				UpdatedAt: &github.Timestamp{Time: testBaseTime.Add(wall)},
+			},
+			Jobs: jobs,
+		}
+	}
+	runs := []*WorkflowRunWithJobs{
+		newRun("completed", 100*time.Second,
+			// a skipped job does not tell the queue time
+			newTestTimedJob("skipped", 0, 0),
+			newTestTimedJob("success", 10*time.Second, 40*time.Second),
+			newTestTimedJob("success", 20*time.Second, 70*time.Second),
+		),
+		newRun("completed", 200*time.Second,
+			newTestTimedJob("failure", 30*time.Second, 150*time.Second),
+		),
+		newRun("in_progress", 300*time.Second,
+			newTestTimedJob("success", time.Second, time.Second),
+		),
+	}
+	// a re-run is measured from when the attempt started
+	rerun := newRun("completed", 1150*time.Second,
+		newTestTimedJob("success", 1020*time.Second, 130*time.Second),
+	)
+	rerun.RunAttempt = 2
+	rerun.RunStartedAt = &github.Timestamp{Time: testBaseTime.Add(1000 * time.Second)}
+	// created_at of a re-run is when the first attempt started, so a re-run without run_started_at is skipped
+	unknownRerun := newRun("completed", 1000*time.Second,
+		newTestTimedJob("success", 900*time.Second, 10*time.Second),
+	)
+	unknownRerun.RunAttempt = 2
+	runs = append(runs, rerun, unknownRerun)
+
+	profiles, err := ProfileWorkflowRunTimes(runs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][3]float64{
+		// min, max, mean
+		runMetricQueue:   {10, 30, 20},
+		runMetricWall:    {100, 200, 150},
+		runMetricCompute: {110, 150, 130},
+	}
+	if len(profiles) != len(expected) {
+		t.Fatalf("expected %d profiles, got %d", len(expected), len(profiles))
+	}
+	for _, p := range profiles {
+		e := expected[p.Name]
+		if p.Runs != 3 || p.Min != e[0] || p.Max != e[1] || p.Mean != e[2] {
+			t.Errorf("%s: unexpected stats: runs=%d, min=%f, max=%f, mean=%f", p.Name, p.Runs, p.Min, p.Max, p.Mean)
+		}
+	}
+}
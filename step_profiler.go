@@ -3,6 +3,7 @@ package ghaprofiler
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 
 	"github.com/google/go-github/v32/github"
 	"github.com/montanaflynn/stats"
@@ -17,6 +18,20 @@ type TaskStepProfile struct {
 	Median      float64                   `json:"median"`
 	Mean        float64                   `json:"mean"`
 	Percentiles map[int64]*percentileData `json:"percentiles"`
+	Executed    int                       `json:"executed"`
+	Skipped     int                       `json:"skipped"`
+	// Incomplete is the number of steps which are queued or in progress
+	Incomplete  int            `json:"incomplete"`
+	Conclusions map[string]int `json:"conclusions"`
+	// Names are names of the steps in the order of appearance, which are set only if the steps have several names
+	Names []string `json:"names,omitempty"`
+	// Numbers are numbers of the steps in the order of appearance, which are set only if the steps have several numbers
+	Numbers []int64 `json:"numbers,omitempty"`
+}
+
+// HasIdentityChanged reports whether steps of the profile had several names or several numbers
+func (p *TaskStepProfile) HasIdentityChanged() bool {
+	return len(p.Names) > 1 || len(p.Numbers) > 1
 }
 
 var percentiles = []int64{
@@ -45,59 +60,308 @@ func (pd percentileData) SortKey() string {
 
 type TaskStepProfileResult = []*TaskStepProfile
 
-func ProfileTaskStep(steps []*github.TaskStep) (profileResult TaskStepProfileResult, err error) {
-	taskStepsByNumber := make(map[int64][]*github.TaskStep)
+const (
+	StepKeyNumber  = "number"
+	StepKeyName    = "name"
+	StepKeyAligned = "aligned"
+)
 
-	// aggregate tasks by its number
-	for _, step := range steps {
-		taskStepsByNumber[*step.Number] = append(taskStepsByNumber[*step.Number], step)
+var availableStepKeys = []string{
+	StepKeyNumber,
+	StepKeyName,
+	StepKeyAligned,
+}
+
+func IsValidStepKey(stepKey string) bool {
+	for _, available := range availableStepKeys {
+		if stepKey == available {
+			return true
+		}
+	}
+	return false
+}
+
+type ProfileTaskStepOptions struct {
+	// IncludeAllSteps includes skipped and cancelled steps in timing statistics
+	IncludeAllSteps bool
+	// StepKey is how to identify the same step among jobs (default: StepKeyNumber)
+	StepKey string
+}
+
+const (
+	stepStatusCompleted     = "completed"
+	stepConclusionSuccess   = "success"
+	stepConclusionFailure   = "failure"
+	stepConclusionSkipped   = "skipped"
+	stepConclusionCancelled = "cancelled"
+)
+
+// taskStepConclusion returns the conclusion of a completed step, or the status otherwise
+func taskStepConclusion(step *github.TaskStep) string {
+	if step.GetStatus() != stepStatusCompleted {
+		return step.GetStatus()
+	}
+	return step.GetConclusion()
+}
+
+// isExecutedTaskStep reports whether the step ran to the end
+func isExecutedTaskStep(step *github.TaskStep) bool {
+	if step.GetStatus() != stepStatusCompleted {
+		return false
+	}
+	switch step.GetConclusion() {
+	case stepConclusionSkipped, stepConclusionCancelled:
+		return false
 	}
+	return true
+}
 
-	for stepNumber, steps := range taskStepsByNumber {
+// taskStepElapsedSeconds returns false if the step does not have both timestamps
+func taskStepElapsedSeconds(step *github.TaskStep) (float64, bool) {
+	if step.StartedAt == nil || step.CompletedAt == nil {
+		return 0, false
+	}
+	elapsed := step.CompletedAt.Sub(step.StartedAt.Time)
+	return float64(elapsed.Nanoseconds()) / 1e9, true
+}
+
+// ProfileTaskStep profiles steps of jobs. Use ProfileTaskStepsOfJobs to align steps with StepKeyAligned,
+// which needs to know which job each step belongs to.
+func ProfileTaskStep(steps []*github.TaskStep, opts *ProfileTaskStepOptions) (TaskStepProfileResult, error) {
+	if opts != nil && opts.StepKey == StepKeyAligned {
+		return nil, fmt.Errorf("Steps of each job are required to align steps")
+	}
+	return ProfileTaskStepsOfJobs([][]*github.TaskStep{steps}, opts)
+}
+
+// ProfileTaskStepsOfJobs profiles steps given for each job
+func ProfileTaskStepsOfJobs(stepsOfJobs [][]*github.TaskStep, opts *ProfileTaskStepOptions) (profileResult TaskStepProfileResult, err error) {
+	if opts == nil {
+		opts = &ProfileTaskStepOptions{}
+	}
+	var steps []*github.TaskStep
+	for _, stepsOfJob := range stepsOfJobs {
+		steps = append(steps, stepsOfJob...)
+	}
+	var taskStepGroups [][]*github.TaskStep
+	switch opts.StepKey {
+	case StepKeyName:
+		taskStepGroups = groupTaskStepsByName(steps)
+	case StepKeyAligned:
+		taskStepGroups = alignTaskSteps(stepsOfJobs)
+	case StepKeyNumber, "":
+		taskStepGroups = groupTaskStepsByNumber(steps)
+	default:
+		return nil, fmt.Errorf("Invalid step key: %s", opts.StepKey)
+	}
+
+	for i, steps := range taskStepGroups {
 		var stepElapsed []float64
-		stepName := steps[0].Name
+		stepName := steps[0].GetName()
+		stepNumber := steps[0].GetNumber()
+		if opts.StepKey == StepKeyAligned {
+			// the position in aligned steps, as the same step may have different numbers
+			stepNumber = int64(i + 1)
+		}
+		executed, skipped, incomplete := 0, 0, 0
+		conclusions := make(map[string]int)
+		var names []string
+		var numbers []int64
+		seenNames := make(map[string]bool)
+		seenNumbers := make(map[int64]bool)
 
 		for _, step := range steps {
-			elapsed := step.CompletedAt.Sub(step.StartedAt.Time)
-			elapsedSeconds := float64(elapsed.Nanoseconds()) / 1e9
-			stepElapsed = append(stepElapsed, elapsedSeconds)
+			if !seenNames[step.GetName()] {
+				seenNames[step.GetName()] = true
+				names = append(names, step.GetName())
+			}
+			if !seenNumbers[step.GetNumber()] {
+				seenNumbers[step.GetNumber()] = true
+				numbers = append(numbers, step.GetNumber())
+			}
+			conclusions[taskStepConclusion(step)]++
+			isExecuted := isExecutedTaskStep(step)
+			switch {
+			case isExecuted:
+				executed++
+			case step.GetStatus() != stepStatusCompleted:
+				incomplete++
+			default:
+				skipped++
+			}
+			if !isExecuted && !opts.IncludeAllSteps {
+				continue
+			}
+			if elapsedSeconds, ok := taskStepElapsedSeconds(step); ok {
+				stepElapsed = append(stepElapsed, elapsedSeconds)
+			}
 		}
 
-		min, err := stats.Min(stepElapsed)
+		durationStats, err := calculateDurationStats(stepElapsed)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to calculate min")
+			return nil, err
 		}
-		max, err := stats.Max(stepElapsed)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to calculate max")
-		}
-		median, err := stats.Median(stepElapsed)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to calculate median")
+		if len(names) <= 1 {
+			names = nil
 		}
-		mean, err := stats.Mean(stepElapsed)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to calculate mean")
-		}
-		percentileResult := map[int64]*percentileData{}
-		for _, percentile := range percentiles {
-			value, err := stats.Percentile(stepElapsed, float64(percentile))
-			if err != nil {
-				return nil, errors.Wrap(err, fmt.Sprintf("failed to calculate %d%%ile", percentile))
-			}
-			percentileResult[percentile] = &percentileData{Percentile: percentile, Value: value}
+		if len(numbers) <= 1 {
+			numbers = nil
 		}
 
 		profileResult = append(profileResult, &TaskStepProfile{
-			Name:        *stepName,
+			Name:        stepName,
 			Number:      stepNumber,
-			Min:         min,
-			Max:         max,
-			Median:      median,
-			Mean:        mean,
-			Percentiles: percentileResult,
+			Min:         durationStats.Min,
+			Max:         durationStats.Max,
+			Median:      durationStats.Median,
+			Mean:        durationStats.Mean,
+			Percentiles: durationStats.Percentiles,
+			Executed:    executed,
+			Skipped:     skipped,
+			Incomplete:  incomplete,
+			Conclusions: conclusions,
+			Names:       names,
+			Numbers:     numbers,
 		})
 	}
 
 	return
 }
+
+// groupTaskStepsByNumber aggregates tasks by its number
+func groupTaskStepsByNumber(steps []*github.TaskStep) [][]*github.TaskStep {
+	var groups [][]*github.TaskStep
+	groupIndexByNumber := make(map[int64]int)
+	for _, step := range steps {
+		i, ok := groupIndexByNumber[step.GetNumber()]
+		if !ok {
+			i = len(groups)
+			groupIndexByNumber[step.GetNumber()] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], step)
+	}
+	return groups
+}
+
+// groupTaskStepsByName aggregates tasks by its name.
+// Each group is ordered by step number so that the first step has the smallest number.
+func groupTaskStepsByName(steps []*github.TaskStep) [][]*github.TaskStep {
+	var groups [][]*github.TaskStep
+	groupIndexByName := make(map[string]int)
+	for _, step := range steps {
+		i, ok := groupIndexByName[step.GetName()]
+		if !ok {
+			i = len(groups)
+			groupIndexByName[step.GetName()] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], step)
+	}
+	for _, group := range groups {
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].GetNumber() < group[j].GetNumber()
+		})
+	}
+	return groups
+}
+
+// alignTaskSteps aligns steps of each job by name and groups steps at the same position.
+// Steps of each job are aligned to the steps of the previous jobs by the longest common subsequence of names,
+// so that steps with the same name are matched in order, and steps added, removed or run conditionally
+// form their own groups without shifting the following steps.
+func alignTaskSteps(stepsOfJobs [][]*github.TaskStep) [][]*github.TaskStep {
+	var groups [][]*github.TaskStep
+	var names []string
+	for _, steps := range stepsOfJobs {
+		n, m := len(names), len(steps)
+		// lcs[i][j] is the length of the longest common subsequence of names[i:] and names of steps[j:]
+		lcs := make([][]int, n+1)
+		for i := range lcs {
+			lcs[i] = make([]int, m+1)
+		}
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if names[i] == steps[j].GetName() {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+
+		var alignedGroups [][]*github.TaskStep
+		var alignedNames []string
+		i, j := 0, 0
+		for i < n || j < m {
+			switch {
+			case i < n && j < m && names[i] == steps[j].GetName():
+				alignedGroups = append(alignedGroups, append(groups[i], steps[j]))
+				alignedNames = append(alignedNames, names[i])
+				i++
+				j++
+			case j == m || (i < n && lcs[i+1][j] >= lcs[i][j+1]):
+				// a step which this job does not have
+				alignedGroups = append(alignedGroups, groups[i])
+				alignedNames = append(alignedNames, names[i])
+				i++
+			default:
+				// a step which the previous jobs do not have
+				alignedGroups = append(alignedGroups, []*github.TaskStep{steps[j]})
+				alignedNames = append(alignedNames, steps[j].GetName())
+				j++
+			}
+		}
+		groups, names = alignedGroups, alignedNames
+	}
+	return groups
+}
+
+type durationStats struct {
+	Min         float64
+	Max         float64
+	Median      float64
+	Mean        float64
+	Percentiles map[int64]*percentileData
+}
+
+// calculateDurationStats returns zero values for every field if there are no samples
+func calculateDurationStats(samples []float64) (*durationStats, error) {
+	result := &durationStats{
+		Percentiles: map[int64]*percentileData{},
+	}
+	for _, percentile := range percentiles {
+		result.Percentiles[percentile] = &percentileData{Percentile: percentile}
+	}
+	if len(samples) == 0 {
+		return result, nil
+	}
+
+	var err error
+	result.Min, err = stats.Min(samples)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to calculate min")
+	}
+	result.Max, err = stats.Max(samples)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to calculate max")
+	}
+	result.Median, err = stats.Median(samples)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to calculate median")
+	}
+	result.Mean, err = stats.Mean(samples)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to calculate mean")
+	}
+	for _, percentile := range percentiles {
+		value, err := stats.Percentile(samples, float64(percentile))
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to calculate %d%%ile", percentile))
+		}
+		result.Percentiles[percentile].Value = value
+	}
+	return result, nil
+}
@@ -0,0 +1,225 @@
+package ghaprofiler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+var testBaseTime = time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestTaskStep(number int64, name, status, conclusion string, elapsedSeconds int) *github.TaskStep {
+	step := &github.TaskStep{
+		Number: github.Int64(number),
+		Name:   github.String(name),
+		Status: github.String(status),
+	}
+	if status == "queued" {
+		return step
+	}
+	step.StartedAt = &github.Timestamp{Time: testBaseTime}
+	if status != stepStatusCompleted {
+		return step
+	}
+	step.Conclusion = github.String(conclusion)
+	step.CompletedAt = &github.Timestamp{Time: testBaseTime.Add(time.Duration(elapsedSeconds) * time.Second)}
+	return step
+}
+
+func Test_ProfileTaskStep_ExcludesSkippedSteps(t *testing.T) {
+	steps := []*github.TaskStep{
+		newTestTaskStep(1, "Test", "completed", "success", 10),
+		newTestTaskStep(1, "Test", "completed", "failure", 20),
+		newTestTaskStep(1, "Test", "completed", "skipped", 0),
+		newTestTaskStep(1, "Test", "completed", "cancelled", 1),
+		newTestTaskStep(1, "Test", "in_progress", "", 0),
+		newTestTaskStep(1, "Test", "queued", "", 0),
+	}
+
+	profile, err := ProfileTaskStep(steps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profile) != 1 {
+		t.Fatalf("expected 1 profile, got %d", len(profile))
+	}
+	p := profile[0]
+	if p.Executed != 2 || p.Skipped != 2 || p.Incomplete != 2 {
+		t.Fatalf("unexpected counts: executed=%d, skipped=%d, incomplete=%d", p.Executed, p.Skipped, p.Incomplete)
+	}
+	if p.Min != 10 || p.Max != 20 || p.Mean != 15 {
+		t.Fatalf("unexpected stats: min=%f, max=%f, mean=%f", p.Min, p.Max, p.Mean)
+	}
+	if p.Conclusions["skipped"] != 1 || p.Conclusions["in_progress"] != 1 || p.Conclusions["queued"] != 1 {
+		t.Fatalf("unexpected conclusions: %#v", p.Conclusions)
+	}
+
+	profile, err = ProfileTaskStep(steps, &ProfileTaskStepOptions{IncludeAllSteps: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = profile[0]
+	if p.Min != 0 || p.Max != 20 {
+		t.Fatalf("unexpected stats with all steps: min=%f, max=%f", p.Min, p.Max)
+	}
+}
+
+func Test_ProfileTaskStep_NoExecutedSteps(t *testing.T) {
+	steps := []*github.TaskStep{
+		newTestTaskStep(1, "Deploy", "completed", "skipped", 0),
+	}
+
+	profile, err := ProfileTaskStep(steps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := profile[0]
+	if p.Executed != 0 || p.Skipped != 1 {
+		t.Fatalf("unexpected counts: executed=%d, skipped=%d", p.Executed, p.Skipped)
+	}
+	if p.Percentiles[99] == nil || p.Percentiles[99].Value != 0 {
+		t.Fatal("percentiles must be filled with zero")
+	}
+}
+
+func Test_ProfileTaskStep_InProgressRun(t *testing.T) {
+	steps := []*github.TaskStep{
+		// a finished run
+		newTestTaskStep(1, "Set up job", "completed", "success", 2),
+		newTestTaskStep(2, "Test", "completed", "success", 10),
+		newTestTaskStep(3, "Deploy", "completed", "skipped", 0),
+		// a run still in progress
+		newTestTaskStep(1, "Set up job", "completed", "success", 4),
+		newTestTaskStep(2, "Test", "in_progress", "", 0),
+		newTestTaskStep(3, "Deploy", "queued", "", 0),
+	}
+
+	profile, err := ProfileTaskStep(steps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		executed, skipped, incomplete int
+		mean                          float64
+	}{
+		{executed: 2, mean: 3},
+		{executed: 1, incomplete: 1, mean: 10},
+		{skipped: 1, incomplete: 1},
+	}
+	if len(profile) != len(expected) {
+		t.Fatalf("expected %d profiles, got %d", len(expected), len(profile))
+	}
+	for i, e := range expected {
+		p := profile[i]
+		if p.Executed != e.executed || p.Skipped != e.skipped || p.Incomplete != e.incomplete || p.Mean != e.mean {
+			t.Errorf("%s: unexpected profile: executed=%d, skipped=%d, incomplete=%d, mean=%f", p.Name, p.Executed, p.Skipped, p.Incomplete, p.Mean)
+		}
+	}
+}
+
+func Test_ProfileTaskStep_StepKeyName(t *testing.T) {
+	steps := []*github.TaskStep{
+		newTestTaskStep(1, "Set up job", "completed", "success", 1),
+		newTestTaskStep(2, "Test", "completed", "success", 10),
+		newTestTaskStep(1, "Set up job", "completed", "success", 3),
+		newTestTaskStep(3, "Test", "completed", "success", 20),
+	}
+
+	profile, err := ProfileTaskStep(steps, &ProfileTaskStepOptions{StepKey: StepKeyName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profile) != 2 {
+		t.Fatalf("expected 2 profiles, got %d", len(profile))
+	}
+	for _, p := range profile {
+		switch p.Name {
+		case "Set up job":
+			if p.Number != 1 || p.Mean != 2 {
+				t.Fatalf("unexpected profile: %#v", p)
+			}
+		case "Test":
+			if p.Number != 2 || p.Mean != 15 {
+				t.Fatalf("unexpected profile: %#v", p)
+			}
+		default:
+			t.Fatalf("unexpected step: %s", p.Name)
+		}
+	}
+}
+
+func Test_ProfileTaskStepsOfJobs_StepKeyAligned(t *testing.T) {
+	stepsOfJobs := [][]*github.TaskStep{
+		// "Lint" was added to the latest job, and "Deploy" runs only in the second job
+		{
+			newTestTaskStep(1, "Checkout", "completed", "success", 1),
+			newTestTaskStep(2, "Lint", "completed", "success", 5),
+			newTestTaskStep(3, "Test", "completed", "success", 10),
+			newTestTaskStep(4, "Checkout", "completed", "success", 2),
+			newTestTaskStep(5, "Test", "completed", "success", 20),
+		},
+		// the last step of the first job is followed by a step with a larger number
+		{
+			newTestTaskStep(6, "Checkout", "completed", "success", 3),
+			newTestTaskStep(7, "Test", "completed", "success", 30),
+			newTestTaskStep(8, "Checkout", "completed", "success", 4),
+			newTestTaskStep(9, "Test", "completed", "success", 40),
+			newTestTaskStep(10, "Deploy", "completed", "success", 50),
+		},
+	}
+
+	if _, err := ProfileTaskStep(stepsOfJobs[0], &ProfileTaskStepOptions{StepKey: StepKeyAligned}); err == nil {
+		t.Fatal("steps are aligned without jobs")
+	}
+	profile, err := ProfileTaskStepsOfJobs(stepsOfJobs, &ProfileTaskStepOptions{StepKey: StepKeyAligned})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		name     string
+		executed int
+		mean     float64
+		numbers  []int64
+	}{
+		{name: "Checkout", executed: 2, mean: 2, numbers: []int64{1, 6}},
+		{name: "Lint", executed: 1, mean: 5},
+		{name: "Test", executed: 2, mean: 20, numbers: []int64{3, 7}},
+		{name: "Checkout", executed: 2, mean: 3, numbers: []int64{4, 8}},
+		{name: "Test", executed: 2, mean: 30, numbers: []int64{5, 9}},
+		{name: "Deploy", executed: 1, mean: 50},
+	}
+	if len(profile) != len(expected) {
+		t.Fatalf("expected %d profiles, got %d", len(expected), len(profile))
+	}
+	for i, e := range expected {
+		p := profile[i]
+		if p.Number != int64(i+1) || p.Name != e.name || p.Executed != e.executed || p.Mean != e.mean {
+			t.Errorf("expected #%d %s: executed=%d, mean=%f, got #%d %s: executed=%d, mean=%f", i+1, e.name, e.executed, e.mean, p.Number, p.Name, p.Executed, p.Mean)
+		}
+		if !reflect.DeepEqual(p.Numbers, e.numbers) {
+			t.Errorf("%s: expected numbers %v, got %v", p.Name, e.numbers, p.Numbers)
+		}
+	}
+}
+
+func Test_ProfileTaskStep_IdentityChanged(t *testing.T) {
+	steps := []*github.TaskStep{
+		newTestTaskStep(1, "Set up job", "completed", "success", 1),
+		newTestTaskStep(2, "Lint", "completed", "success", 5),
+		newTestTaskStep(1, "Set up job", "completed", "success", 1),
+		newTestTaskStep(2, "Test", "completed", "success", 10),
+	}
+
+	profile, err := ProfileTaskStep(steps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile[0].HasIdentityChanged() {
+		t.Errorf("unexpected identity change: %#v", profile[0])
+	}
+	if !profile[1].HasIdentityChanged() || !reflect.DeepEqual(profile[1].Names, []string{"Lint", "Test"}) {
+		t.Errorf("expected names of step 2, got %v", profile[1].Names)
+	}
+}
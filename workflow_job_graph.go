@@ -0,0 +1,206 @@
+package ghaprofiler
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"gopkg.in/yaml.v2"
+)
+
+// workflowJobGraph is the dependency graph of jobs given by needs in a workflow file
+type workflowJobGraph struct {
+	// jobIDs are sorted to match job names in a stable order
+	jobIDs []string
+	names  map[string]*regexp.Regexp
+	needs  map[string][]string
+}
+
+// workflowJobGraphKey identifies a revision of a workflow file
+type workflowJobGraphKey struct {
+	repository string
+	revision   string
+}
+
+// yamlStringList is a string or a list of strings in YAML
+type yamlStringList []string
+
+func (l *yamlStringList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		*l = yamlStringList{s}
+		return nil
+	}
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+type workflowFile struct {
+	Jobs map[string]struct {
+		Name  string         `yaml:"name"`
+		Needs yamlStringList `yaml:"needs"`
+	} `yaml:"jobs"`
+}
+
+var workflowExpressionRegexp = regexp.MustCompile(`\$\{\{.*?\}\}`)
+
+// jobNamePattern matches names of jobs of a job in a workflow file. Expressions in the name match anything,
+// and matrix jobs have their matrix values in parentheses unless the name has them.
+func jobNamePattern(name string) *regexp.Regexp {
+	var pattern strings.Builder
+	last := 0
+	for _, loc := range workflowExpressionRegexp.FindAllStringIndex(name, -1) {
+		pattern.WriteString(regexp.QuoteMeta(name[last:loc[0]]))
+		pattern.WriteString(".*")
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(name[last:]))
+	return regexp.MustCompile(`^` + pattern.String() + `( \(.*\))?$`)
+}
+
+// parseWorkflowJobGraph parses jobs and their needs in a workflow file
+func parseWorkflowJobGraph(content []byte) (*workflowJobGraph, error) {
+	var file workflowFile
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, err
+	}
+	graph := &workflowJobGraph{
+		names: make(map[string]*regexp.Regexp),
+		needs: make(map[string][]string),
+	}
+	for id, job := range file.Jobs {
+		graph.jobIDs = append(graph.jobIDs, id)
+		name := job.Name
+		if name == "" {
+			name = id
+		}
+		graph.names[id] = jobNamePattern(name)
+		graph.needs[id] = job.Needs
+	}
+	sort.Strings(graph.jobIDs)
+	return graph, nil
+}
+
+// jobID returns the ID in the workflow file of a job of a workflow run.
+// A job of a reusable workflow is named after the calling job followed by " / ".
+func (g *workflowJobGraph) jobID(jobName string) (string, bool) {
+	candidates := []string{jobName}
+	if i := strings.Index(jobName, " / "); i >= 0 {
+		candidates = append(candidates, jobName[:i])
+	}
+	for _, name := range candidates {
+		if _, ok := g.needs[name]; ok {
+			return name, true
+		}
+		for _, id := range g.jobIDs {
+			if g.names[id].MatchString(name) {
+				return id, true
+			}
+		}
+	}
+	return "", false
+}
+
+// localWorkflowFileContent returns the content of a revision of a workflow file in the local repository.
+// ok is false if the blob is not found.
+func localWorkflowFileContent(repo *git.Repository, revision string) (content []byte, ok bool, err error) {
+	blob, err := repo.BlobObject(plumbing.NewHash(revision))
+	if err != nil {
+		if err == plumbing.ErrObjectNotFound {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	r, err := blob.Reader()
+	if err != nil {
+		return nil, false, err
+	}
+	defer r.Close()
+	content, err = ioutil.ReadAll(r)
+	if err != nil {
+		return nil, false, err
+	}
+	return content, true, nil
+}
+
+// loadWorkflowJobGraphs loads the job graph of the workflow file of each revision of the workflow runs,
+// from the local git repository of the current directory if it has the revision, or from GitHub.
+// Revisions which are not loaded are missing in the result, and only an error of ctx is returned.
+func (p *Profiler) loadWorkflowJobGraphs(ctx context.Context, workflowRuns []*WorkflowRunWithJobs) (map[workflowJobGraphKey]*workflowJobGraph, error) {
+	if !p.config.UsesRevisions() {
+		if err := p.resolveWorkflowRevisions(ctx, workflowRuns); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			p.logf("%v; queue times of jobs are measured from the start of workflow runs", err)
+		}
+	}
+
+	var localRepo *git.Repository
+	var localRepository string
+	if repo, remoteURL, err := openLocalRepository(p.config.Remote); err == nil {
+		localRepo, localRepository = repo, remoteURL.Repository.String()
+	}
+
+	graphs := make(map[workflowJobGraphKey]*workflowJobGraph)
+	loaded := make(map[workflowJobGraphKey]bool)
+	for _, run := range workflowRuns {
+		key := workflowJobGraphKey{repository: run.Repository, revision: run.Revision}
+		if key.revision == "" || loaded[key] {
+			continue
+		}
+		loaded[key] = true
+
+		content, err := p.workflowFileContent(ctx, localRepo, localRepository, key)
+		if err != nil {
+			if ctx.Err() != nil {
+				return graphs, ctx.Err()
+			}
+			p.logfVerbose("Needs of jobs of %s at %s are unknown: %v", run.WorkflowFileName, shortRevision(key.revision), err)
+			continue
+		}
+		graph, err := parseWorkflowJobGraph(content)
+		if err != nil {
+			p.logfVerbose("Needs of jobs of %s at %s are unknown: %v", run.WorkflowFileName, shortRevision(key.revision), err)
+			continue
+		}
+		graphs[key] = graph
+	}
+	return graphs, nil
+}
+
+// workflowFileContent returns the content of a revision of a workflow file from the local repository if it has,
+// or from GitHub
+func (p *Profiler) workflowFileContent(ctx context.Context, localRepo *git.Repository, localRepository string, key workflowJobGraphKey) ([]byte, error) {
+	if localRepo != nil && strings.EqualFold(key.repository, localRepository) {
+		content, ok, err := localWorkflowFileContent(localRepo, key.revision)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return content, nil
+		}
+	}
+	if p.client == nil {
+		if p.database == nil {
+			return nil, fmt.Errorf("The revision is not found in the local repository")
+		}
+		if err := p.prepareClient(ctx); err != nil {
+			return nil, err
+		}
+	}
+	repository, err := ParseRepositoryName(key.repository)
+	if err != nil {
+		return nil, err
+	}
+	return p.client.GetWorkflowFileContent(ctx, repository.Owner, repository.Name, key.revision)
+}
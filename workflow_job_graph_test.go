@@ -0,0 +1,47 @@
+package ghaprofiler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_WorkflowJobGraph(t *testing.T) {
+	graph, err := parseWorkflowJobGraph([]byte(`
+on: push
+jobs:
+  lint:
+    runs-on: ubuntu-latest
+  test:
+    name: Test on ${{ matrix.os }}
+    needs: lint
+  release:
+    uses: ./.github/workflows/release.yml
+    needs: [lint, test]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		jobName  string
+		expected string
+	}{
+		{jobName: "lint", expected: "lint"},
+		{jobName: "lint (1.15)", expected: "lint"},
+		{jobName: "Test on ubuntu-latest", expected: "test"},
+		{jobName: "Test on ubuntu-latest (1.15)", expected: "test"},
+		{jobName: "release / publish", expected: "release"},
+		{jobName: "unknown", expected: ""},
+	} {
+		id, ok := graph.jobID(tc.jobName)
+		if id != tc.expected || ok != (tc.expected != "") {
+			t.Errorf("%s: expected %q, got %q", tc.jobName, tc.expected, id)
+		}
+	}
+	if !reflect.DeepEqual(graph.needs["test"], []string{"lint"}) || !reflect.DeepEqual(graph.needs["release"], []string{"lint", "test"}) {
+		t.Fatalf("unexpected needs: %v", graph.needs)
+	}
+
+	if _, err := parseWorkflowJobGraph([]byte("jobs: [")); err == nil {
+		t.Fatal("an invalid workflow file is parsed")
+	}
+}
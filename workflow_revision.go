@@ -0,0 +1,215 @@
+package ghaprofiler
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// RevisionLatest matches the revision of the newest workflow run of each workflow
+	RevisionLatest = "latest"
+	// revisionUnknown groups workflow runs whose revision is not resolved
+	revisionUnknown = "unknown"
+)
+
+var revisionPattern = regexp.MustCompile(`^[0-9a-f]{4,40}$`)
+
+// IsValidRevision reports whether revision is RevisionLatest or an abbreviated or full blob SHA
+func IsValidRevision(revision string) bool {
+	return revision == RevisionLatest || revisionPattern.MatchString(revision)
+}
+
+// workflowFilePath returns the path of the workflow file in a repository
+func workflowFilePath(workflowFileName string) string {
+	return path.Join(".github", "workflows", workflowFileName)
+}
+
+// shortRevision abbreviates a revision in the same way as git
+func shortRevision(revision string) string {
+	if len(revision) > 7 {
+		return revision[:7]
+	}
+	return revision
+}
+
+// localWorkflowRevision returns the blob SHA of the workflow file at the commit in the local repository,
+// or an empty string if the file does not exist at the commit. ok is false if the commit is not found.
+func localWorkflowRevision(repo *git.Repository, workflowFileName, commitSHA string) (revision string, ok bool, err error) {
+	commit, err := repo.CommitObject(plumbing.NewHash(commitSHA))
+	if err != nil {
+		if err == plumbing.ErrObjectNotFound {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return "", false, err
+	}
+	entry, err := tree.FindEntry(workflowFilePath(workflowFileName))
+	if err != nil {
+		if err == object.ErrEntryNotFound || err == object.ErrDirectoryNotFound {
+			return "", true, nil
+		}
+		return "", false, err
+	}
+	return entry.Hash.String(), true, nil
+}
+
+// resolveWorkflowRevisions sets Revision of workflow runs which do not have it, from the local git repository
+// of the current directory if it has the head commit, or from GitHub unless workflow runs are given or loaded from files
+func (p *Profiler) resolveWorkflowRevisions(ctx context.Context, workflowRuns []*WorkflowRunWithJobs) error {
+	var localRepo *git.Repository
+	var localRepository string
+	if repo, remoteURL, err := openLocalRepository(p.config.Remote); err != nil {
+		p.logfVerbose("Revisions are not resolved from the local repository: %v", err)
+	} else {
+		localRepo, localRepository = repo, remoteURL.Repository.String()
+	}
+
+	type revisionKey struct {
+		repository       string
+		workflowFileName string
+		commitSHA        string
+	}
+	var keys []revisionKey
+	runsByKey := make(map[revisionKey][]*WorkflowRunWithJobs)
+	for _, run := range workflowRuns {
+		if run.Revision != "" || run.Run.GetHeadSHA() == "" {
+			continue
+		}
+		key := revisionKey{repository: run.Repository, workflowFileName: run.WorkflowFileName, commitSHA: run.Run.GetHeadSHA()}
+		if _, ok := runsByKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		runsByKey[key] = append(runsByKey[key], run)
+	}
+
+	var remoteKeys []revisionKey
+	for _, key := range keys {
+		if localRepo != nil && strings.EqualFold(key.repository, localRepository) {
+			revision, ok, err := localWorkflowRevision(localRepo, key.workflowFileName, key.commitSHA)
+			if err != nil {
+				return err
+			}
+			if ok {
+				for _, run := range runsByKey[key] {
+					run.Revision = revision
+				}
+				continue
+			}
+		}
+		remoteKeys = append(remoteKeys, key)
+	}
+	if len(remoteKeys) == 0 {
+		return nil
+	}
+	if p.client == nil && p.database == nil {
+		// revisions are also resolved for needs of jobs, which are not essential
+		logf := p.logfVerbose
+		if p.config.UsesRevisions() {
+			logf = p.logf
+		}
+		logf("Revisions of the workflow file at %d commits are unknown, as they are not found in the local repository", len(remoteKeys))
+		return nil
+	}
+	// workflow runs in the database may be synced by an older version which did not store revisions
+	if err := p.prepareClient(ctx); err != nil {
+		p.logf("Revisions of the workflow file at %d commits are unknown, as a client for GitHub is not created: %v", len(remoteKeys), err)
+		return nil
+	}
+
+	// an error of a goroutine cancels the others
+	eg, egCtx := errgroup.WithContext(ctx)
+	var acquireErr error
+	for _, key := range remoteKeys {
+		key := key
+		repository, err := ParseRepositoryName(key.repository)
+		if err != nil {
+			p.logfVerbose("%v", err)
+			continue
+		}
+		if acquireErr = p.limiter.Acquire(egCtx); acquireErr != nil {
+			break
+		}
+		eg.Go(func() error {
+			defer p.limiter.Release()
+			revision, err := p.client.GetWorkflowFileRevision(egCtx, repository.Owner, repository.Name, key.workflowFileName, key.commitSHA)
+			if err != nil {
+				return fmt.Errorf("Failed to resolve the revision of %s of %s at %s: %v", key.workflowFileName, key.repository, key.commitSHA, err)
+			}
+			for _, run := range runsByKey[key] {
+				run.Revision = revision
+			}
+			return nil
+		})
+	}
+
+	err := eg.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+	return acquireErr
+}
+
+// applyRevisions resolves revisions of workflow runs, and filters them by the revision option if passed.
+// Workflow runs are filtered even if resolving fails.
+func (p *Profiler) applyRevisions(ctx context.Context, workflowRuns []*WorkflowRunWithJobs) ([]*WorkflowRunWithJobs, error) {
+	err := p.resolveWorkflowRevisions(ctx, workflowRuns)
+	if len(p.config.Revisions) > 0 {
+		workflowRuns = filterWorkflowRunsByRevision(workflowRuns, p.config.Revisions)
+		p.logf("Analyzing %d workflow runs of revision %s", len(workflowRuns), strings.Join(p.config.Revisions, ", "))
+	}
+	return workflowRuns, err
+}
+
+// filterWorkflowRunsByRevision returns workflow runs whose revision starts with any of revisions.
+// RevisionLatest matches the revision of the newest workflow run of each workflow whose revision is resolved.
+func filterWorkflowRunsByRevision(workflowRuns []*WorkflowRunWithJobs, revisions []string) []*WorkflowRunWithJobs {
+	type workflowKey struct {
+		repository       string
+		workflowFileName string
+	}
+	latestRevisions := make(map[workflowKey]string)
+	latestCreatedAt := make(map[workflowKey]time.Time)
+	for _, run := range workflowRuns {
+		if run.Revision == "" {
+			continue
+		}
+		key := workflowKey{repository: run.Repository, workflowFileName: run.WorkflowFileName}
+		createdAt := run.Run.GetCreatedAt().Time
+		if _, ok := latestRevisions[key]; !ok || createdAt.After(latestCreatedAt[key]) {
+			latestRevisions[key] = run.Revision
+			latestCreatedAt[key] = createdAt
+		}
+	}
+
+	var filtered []*WorkflowRunWithJobs
+	for _, run := range workflowRuns {
+		if run.Revision == "" {
+			continue
+		}
+		for _, revision := range revisions {
+			if revision == RevisionLatest {
+				revision = latestRevisions[workflowKey{repository: run.Repository, workflowFileName: run.WorkflowFileName}]
+			}
+			if strings.HasPrefix(run.Revision, revision) {
+				filtered = append(filtered, run)
+				break
+			}
+		}
+	}
+	return filtered
+}
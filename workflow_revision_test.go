@@ -0,0 +1,155 @@
+package ghaprofiler
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/google/go-github/v32/github"
+)
+
+func Test_LocalWorkflowRevision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, ".github", "workflows"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ".github", "workflows", "ci.yml"), []byte("on: push\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	blobHash, err := worktree.Add(".github/workflows/ci.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitHash, err := worktree.Commit("Add CI", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: testBaseTime},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revision, ok, err := localWorkflowRevision(repo, "ci.yml", commitHash.String())
+	if err != nil || !ok || revision != blobHash.String() {
+		t.Errorf("expected revision %s, got %q, ok=%v, err=%v", blobHash, revision, ok, err)
+	}
+	// the workflow file does not exist at the commit
+	revision, ok, err = localWorkflowRevision(repo, "release.yml", commitHash.String())
+	if err != nil || !ok || revision != "" {
+		t.Errorf("expected no revision, got %q, ok=%v, err=%v", revision, ok, err)
+	}
+	// the commit is not in the local repository
+	_, ok, err = localWorkflowRevision(repo, "ci.yml", "0123456789abcdef0123456789abcdef01234567")
+	if err != nil || ok {
+		t.Errorf("expected the commit not found, got ok=%v, err=%v", ok, err)
+	}
+}
+
+func Test_FilterWorkflowRunsByRevision(t *testing.T) {
+	newRun := func(repository string, id int64, revision string) *WorkflowRunWithJobs {
+		run := newTestStoredRun(repository, "ci.yml", id, "completed")
+		run.Revision = revision
+		return run
+	}
+	runs := []*WorkflowRunWithJobs{
+		newRun("owner/repo", 1, "aaaa1111"),
+		newRun("owner/repo", 2, "bbbb2222"),
+		newRun("owner/repo", 3, ""),
+		newRun("owner/other", 4, "cccc3333"),
+		newRun("owner/other", 5, "aaaa1111"),
+	}
+	testCases := []struct {
+		revisions []string
+		expected  []int64
+	}{
+		{revisions: []string{"aaaa"}, expected: []int64{1, 5}},
+		{revisions: []string{"bbbb2222", "cccc"}, expected: []int64{2, 4}},
+		// the newest run of each workflow whose revision is known
+		{revisions: []string{RevisionLatest}, expected: []int64{2, 5}},
+	}
+	for _, tc := range testCases {
+		var got []int64
+		for _, run := range filterWorkflowRunsByRevision(runs, tc.revisions) {
+			got = append(got, run.Run.GetID())
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%v: expected %v, got %v", tc.revisions, tc.expected, got)
+		}
+	}
+}
+
+func Test_IsValidRevision(t *testing.T) {
+	for revision, expected := range map[string]bool{
+		"latest":   true,
+		"abcd":     true,
+		"abc":      false,
+		"ABCD":     false,
+		"abcd1234": true,
+		"main":     false,
+	} {
+		if IsValidRevision(revision) != expected {
+			t.Errorf("%s: expected %v", revision, expected)
+		}
+	}
+}
+
+func Test_ResolveWorkflowRevisionsFromDatabase(t *testing.T) {
+	db, teardown := newTestDatabase(t)
+	defer teardown()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/repos/owner/repo/contents/.github/workflows/ci.yml") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(&github.RepositoryContent{
+			Type: github.String("file"),
+			Path: github.String(".github/workflows/ci.yml"),
+			SHA:  github.String("aaaa1111"),
+		})
+	}))
+	defer server.Close()
+
+	// synced by a version which did not store revisions
+	stored := newTestStoredRun("owner/repo", "ci.yml", 1, "completed")
+	stored.Run.HeadSHA = github.String("0123456789abcdef0123456789abcdef01234567")
+	if err := db.PutWorkflowRuns([]*WorkflowRunWithJobs{stored}); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultProfileConfig()
+	config.Owner = "owner"
+	config.Repository = "repo"
+	config.WorkflowFiles = []string{"ci.yml"}
+	config.AccessToken = "token"
+	config.BaseURL = server.URL
+	config.Remote = "no-such-remote"
+	p := newTestProfiler(t, WithConfig(config), WithDatabase(db), WithGroupByRevision(), WithLogger(log.New(ioutil.Discard, "", 0)))
+	result, err := p.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.WorkflowRuns) != 1 || result.WorkflowRuns[0].Revision != "aaaa1111" {
+		t.Fatalf("expected the revision resolved from GitHub, got %+v", result.WorkflowRuns)
+	}
+}
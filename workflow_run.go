@@ -0,0 +1,41 @@
+package ghaprofiler
+
+import (
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// WorkflowRunAttempt is the attempt of a workflow run, which go-github v32 does not decode
+type WorkflowRunAttempt struct {
+	// RunAttempt is 1 for the first attempt, and 0 if unknown
+	RunAttempt int `json:"run_attempt,omitempty"`
+	// RunStartedAt is when the attempt started
+	RunStartedAt *github.Timestamp `json:"run_started_at,omitempty"`
+}
+
+// WorkflowRun is a workflow run decoded with its attempt
+type WorkflowRun struct {
+	*github.WorkflowRun
+	WorkflowRunAttempt
+}
+
+// WorkflowRuns is github.WorkflowRuns decoded with attempts
+type WorkflowRuns struct {
+	TotalCount   *int           `json:"total_count,omitempty"`
+	WorkflowRuns []*WorkflowRun `json:"workflow_runs,omitempty"`
+}
+
+// workflowRunStartedAt returns when the attempt of the workflow run started.
+// created_at is when the first attempt started, so it is used only if the run is not a re-run.
+func workflowRunStartedAt(run *WorkflowRunWithJobs) (time.Time, bool) {
+	if run.RunStartedAt != nil {
+		return run.RunStartedAt.Time, true
+	}
+	// Run is nil for an input without the workflow run
+	createdAt := run.Run.GetCreatedAt()
+	if run.RunAttempt > 1 || createdAt.IsZero() {
+		return time.Time{}, false
+	}
+	return createdAt.Time, true
+}